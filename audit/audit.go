@@ -0,0 +1,392 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/callback"
+	"github.com/zhang1github2test/gorm-learning/reqctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 审计记录的操作类型
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Redacted 加密字段在审计记录中的值
+const Redacted = "[REDACTED]"
+
+// Log audit_logs 表的记录，每条被修改的记录一行
+type Log struct {
+	ID         uint   `gorm:"primaryKey"`
+	Operation  string `gorm:"size:16"`
+	Table      string `gorm:"column:table_name;size:64;index:idx_audit_logs_row"`
+	PrimaryKey string `gorm:"size:128;index:idx_audit_logs_row"`
+	// Changes 变化的列，JSON 格式：{"列名":{"old":旧值,"new":新值}}，新增时没有 old，删除时没有 new
+	Changes   string    `gorm:"type:text"`
+	Actor     string    `gorm:"size:128;index"`
+	RequestID string    `gorm:"size:64;index"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName 审计表名
+func (Log) TableName() string {
+	return "audit_logs"
+}
+
+// Change 一列的旧值和新值
+type Change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// WithRequestID 在 context 中设置请求 ID，通过 db.WithContext(ctx) 传给写操作。操作者使用 callback.WithActor 设置
+//
+// Deprecated: 使用 reqctx.WithRequestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return reqctx.WithRequestID(ctx, requestID)
+}
+
+// RequestIDFromContext 返回 WithRequestID 设置的请求 ID
+//
+// Deprecated: 使用 reqctx.RequestIDFromContext
+func RequestIDFromContext(ctx context.Context) string {
+	return reqctx.RequestIDFromContext(ctx)
+}
+
+// Config 审计配置
+type Config struct {
+	// RedactTags 带有这些 struct tag 的字段在审计记录中只记录是否变化，值替换为 Redacted，
+	// 为空时为 db 上注册的加解密插件的 tag（callback.Config.TagName，默认 encryption）和 callback.HashTag
+	RedactTags []string
+}
+
+// auditor 审计回调
+type auditor struct {
+	config Config
+}
+
+// snapshotKey 语句中保存修改前记录的 key
+const snapshotKey = "audit:snapshot"
+
+// Migrate 创建或更新 audit_logs 表，部署时执行一次（myapp migrate-audit），Register 不会建表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Log{})
+}
+
+// Register 注册审计回调：新增、更新、删除后把每条记录的变化写入 audit_logs，表需要先通过 Migrate 创建。
+// 审计记录与修改使用同一个事务，写入失败时修改回滚；关闭默认事务（SkipDefaultTransaction）时只是在同一个连接池中依次执行。
+// 更新和删除前按语句的条件查询一次修改前的记录，更新后按主键再查询一次，批量修改大量记录时开销较大。
+// 只审计通过模型执行的语句，db.Table("xxx")、Exec 等没有模型的语句不记录
+func Register(db *gorm.DB, config Config) error {
+	a := &auditor{config: config}
+	db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("customer:audit_create", a.afterCreate)
+	db.Callback().Update().After("gorm:begin_transaction").Before("gorm:before_update").Register("customer:audit_update_snapshot", a.snapshot)
+	db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("customer:audit_update", a.afterUpdate)
+	db.Callback().Delete().After("gorm:begin_transaction").Before("gorm:before_delete").Register("customer:audit_delete_snapshot", a.snapshot)
+	db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("customer:audit_delete", a.afterDelete)
+	return nil
+}
+
+// audited 判断语句是否需要审计
+func audited(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement.Schema != nil && db.Statement.Schema.Table != (Log{}).TableName()
+}
+
+func (a *auditor) afterCreate(db *gorm.DB) {
+	if !audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+	var rows []map[string]interface{}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		rows = append(rows, a.columnsOfMap(db.Statement.Schema, dest))
+	case []map[string]interface{}:
+		for _, m := range dest {
+			rows = append(rows, a.columnsOfMap(db.Statement.Schema, m))
+		}
+	default:
+		rows = a.columnsOf(db, db.Statement.ReflectValue)
+	}
+
+	logs := make([]Log, 0, len(rows))
+	for _, row := range rows {
+		changes := map[string]Change{}
+		for column, value := range row {
+			if value != nil {
+				changes[column] = Change{New: value}
+			}
+		}
+		logs = append(logs, a.newLog(db, OpCreate, row, changes))
+	}
+	a.write(db, logs)
+}
+
+func (a *auditor) afterUpdate(db *gorm.DB) {
+	olds, ok := a.snapshotOf(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	news := a.query(db, a.byPrimaryKeys(db.Statement.Schema, olds))
+	newByKey := make(map[string]map[string]interface{}, len(news))
+	for _, row := range news {
+		newByKey[primaryKeyOf(db.Statement.Schema, row)] = row
+	}
+
+	var logs []Log
+	for _, old := range olds {
+		row, ok := newByKey[primaryKeyOf(db.Statement.Schema, old)]
+		if !ok {
+			continue
+		}
+		changes := map[string]Change{}
+		for column, value := range row {
+			if !reflect.DeepEqual(old[column], value) {
+				changes[column] = Change{Old: old[column], New: value}
+			}
+		}
+		if len(changes) > 0 {
+			logs = append(logs, a.newLog(db, OpUpdate, row, changes))
+		}
+	}
+	a.write(db, logs)
+}
+
+func (a *auditor) afterDelete(db *gorm.DB) {
+	olds, ok := a.snapshotOf(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	logs := make([]Log, 0, len(olds))
+	for _, old := range olds {
+		changes := map[string]Change{}
+		for column, value := range old {
+			if value != nil {
+				changes[column] = Change{Old: value}
+			}
+		}
+		logs = append(logs, a.newLog(db, OpDelete, old, changes))
+	}
+	a.write(db, logs)
+}
+
+// snapshot 更新和删除前按语句的条件查询修改前的记录，没有任何条件（AllowGlobalUpdate）时不查询
+func (a *auditor) snapshot(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	var exprs []clause.Expression
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+	// db.Model(&user).Updates(...)、db.Delete(&user) 的主键条件在执行时才加入，这里按模型的主键补上
+	if rv := db.Statement.ReflectValue; rv.Kind() == reflect.Struct {
+		for _, field := range db.Statement.Schema.PrimaryFields {
+			if value, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+				exprs = append(exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+			}
+		}
+	}
+	if len(exprs) == 0 {
+		return
+	}
+	db.InstanceSet(snapshotKey, a.query(db, exprs))
+}
+
+func (a *auditor) snapshotOf(db *gorm.DB) ([]map[string]interface{}, bool) {
+	if !audited(db) {
+		return nil, false
+	}
+	value, ok := db.InstanceGet(snapshotKey)
+	if !ok {
+		return nil, false
+	}
+	rows := value.([]map[string]interface{})
+	return rows, len(rows) > 0
+}
+
+// query 在语句的事务中按条件查询记录的原始值。跳过钩子，加密列保持密文，不会触发解密和字段访问审计
+func (a *auditor) query(db *gorm.DB, exprs []clause.Expression) []map[string]interface{} {
+	var rows []map[string]interface{}
+	if len(exprs) == 0 {
+		return rows
+	}
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface()).
+		Clauses(clause.Where{Exprs: exprs})
+	tx.Statement.Unscoped = db.Statement.Unscoped
+	if err := tx.Find(&rows).Error; err != nil {
+		db.AddError(err)
+		return nil
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+	return rows
+}
+
+// byPrimaryKeys 返回按主键匹配 rows 的条件
+func (a *auditor) byPrimaryKeys(sch *schema.Schema, rows []map[string]interface{}) []clause.Expression {
+	if len(sch.PrimaryFields) == 0 {
+		return nil
+	}
+	conds := make([]clause.Expression, 0, len(rows))
+	for _, row := range rows {
+		eqs := make([]clause.Expression, 0, len(sch.PrimaryFields))
+		for _, field := range sch.PrimaryFields {
+			eqs = append(eqs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: row[field.DBName]})
+		}
+		conds = append(conds, clause.And(eqs...))
+	}
+	return []clause.Expression{clause.Or(conds...)}
+}
+
+// columnsOf 读取新增的结构体（或切片）中每个字段的值，key 为列名
+func (a *auditor) columnsOf(db *gorm.DB, rv reflect.Value) []map[string]interface{} {
+	var rows []map[string]interface{}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, a.columnsOf(db, reflect.Indirect(rv.Index(i)))...)
+		}
+	case reflect.Struct:
+		row := map[string]interface{}{}
+		for _, field := range db.Statement.Schema.Fields {
+			if field.DBName == "" || !field.Creatable {
+				continue
+			}
+			if value, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+				row[field.DBName] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// columnsOfMap 将 Create(map) 的 key 统一为列名
+func (a *auditor) columnsOfMap(sch *schema.Schema, m map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if field := sch.LookUpField(key); field != nil && field.DBName != "" {
+			row[field.DBName] = value
+		}
+	}
+	return row
+}
+
+// redactTags 返回需要隐藏值的 struct tag，加解密插件可能在审计插件之后注册，每次从 db 上读取
+func (a *auditor) redactTags(db *gorm.DB) []string {
+	if len(a.config.RedactTags) > 0 {
+		return a.config.RedactTags
+	}
+	return []string{callback.TagNameOf(db), callback.HashTag}
+}
+
+// redacted 判断列是否需要隐藏值
+func (a *auditor) redacted(sch *schema.Schema, tags []string, column string) bool {
+	field := sch.LookUpField(column)
+	if field == nil {
+		return false
+	}
+	for _, tag := range tags {
+		if value, ok := field.Tag.Lookup(tag); ok && value != "" && value != "-" && !strings.EqualFold(value, "false") {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *auditor) newLog(db *gorm.DB, op string, row map[string]interface{}, changes map[string]Change) Log {
+	sch := db.Statement.Schema
+	tags := a.redactTags(db)
+	for column, change := range changes {
+		if a.redacted(sch, tags, column) {
+			if change.Old != nil {
+				change.Old = Redacted
+			}
+			if change.New != nil {
+				change.New = Redacted
+			}
+			changes[column] = change
+		}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		db.AddError(err)
+	}
+	ctx := db.Statement.Context
+	return Log{
+		Operation:  op,
+		Table:      sch.Table,
+		PrimaryKey: primaryKeyOf(sch, row),
+		Changes:    string(data),
+		Actor:      callback.ActorFromContext(ctx),
+		RequestID:  reqctx.RequestIDFromContext(ctx),
+	}
+}
+
+// write 在语句的事务中写入审计记录，写入失败时语句返回错误，事务回滚。
+// 直接在语句的连接上执行 INSERT，不经过 Create 的回调链，审计记录不会再被加解密、拦截、缓存、指标、追踪和慢查询等插件处理
+func (a *auditor) write(db *gorm.DB, logs []Log) {
+	if len(logs) == 0 || db.Error != nil {
+		return
+	}
+	stmt := &gorm.Statement{
+		DB:       db,
+		ConnPool: db.Statement.ConnPool,
+		Context:  db.Statement.Context,
+		Clauses:  map[string]clause.Clause{},
+		Dest:     logs,
+	}
+	if err := stmt.Parse(&Log{}); err != nil {
+		db.AddError(fmt.Errorf("audit: write audit_logs: %w", err))
+		return
+	}
+	stmt.ReflectValue = reflect.ValueOf(logs)
+	stmt.AddClause(clause.Insert{})
+	stmt.AddClause(callbacks.ConvertToCreateValues(stmt))
+	stmt.Build("INSERT", "VALUES")
+
+	begin := time.Now()
+	result, err := stmt.ConnPool.ExecContext(stmt.Context, stmt.SQL.String(), stmt.Vars...)
+	db.Logger.Trace(stmt.Context, begin, func() (string, int64) {
+		var rows int64
+		if result != nil {
+			rows, _ = result.RowsAffected()
+		}
+		return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...), rows
+	}, err)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: write audit_logs: %w", err))
+	}
+}
+
+// primaryKeyOf 读取记录的主键，联合主键以逗号分隔，没有主键值时返回空字符串
+func primaryKeyOf(sch *schema.Schema, row map[string]interface{}) string {
+	values := make([]string, 0, len(sch.PrimaryFields))
+	for _, field := range sch.PrimaryFields {
+		value, ok := row[field.DBName]
+		if !ok || value == nil {
+			return ""
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
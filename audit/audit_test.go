@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zhang1github2test/gorm-learning/callback"
+	"github.com/zhang1github2test/gorm-learning/reqctx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:32"`
+	Phone     string `gorm:"size:128" encryption:"true"`
+	DeletedAt gorm.DeletedAt
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := callback.Register(db, &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAudit(t *testing.T) {
+	db := newTestDB(t)
+	ctx := reqctx.WithRequestID(callback.WithActor(context.Background(), "admin"), "req-1")
+	tx := db.WithContext(ctx)
+
+	user := testUser{Name: "zhang", Phone: "18601774393"}
+	if err := tx.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Model(&user).Updates(map[string]interface{}{"name": "li", "phone": "18601774394"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 没有变化的更新不记录
+	if err := tx.Model(&user).Update("name", "li").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Where("name = ?", "li").Delete(&testUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []Log
+	if err := db.Order("id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		operation string
+		changes   map[string]Change
+	}{
+		{name: "create", operation: OpCreate, changes: map[string]Change{"id": {New: float64(1)}, "name": {New: "zhang"}, "phone": {New: Redacted}}},
+		{name: "update", operation: OpUpdate, changes: map[string]Change{"name": {Old: "zhang", New: "li"}, "phone": {Old: Redacted, New: Redacted}}},
+		{name: "delete", operation: OpDelete, changes: map[string]Change{"id": {Old: float64(1)}, "name": {Old: "li"}, "phone": {Old: Redacted}}},
+	}
+	if len(logs) != len(tests) {
+		t.Fatalf("audit_logs got %d rows, want %d: %+v", len(logs), len(tests), logs)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := logs[i]
+			if log.Operation != tt.operation || log.Table != "test_users" || log.PrimaryKey != "1" || log.Actor != "admin" || log.RequestID != "req-1" {
+				t.Errorf("log got = %+v", log)
+			}
+			var changes map[string]Change
+			if err := json.Unmarshal([]byte(log.Changes), &changes); err != nil {
+				t.Fatal(err)
+			}
+			for column, want := range tt.changes {
+				if got := changes[column]; got != want {
+					t.Errorf("changes[%s] got = %+v, want %+v", column, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAudit_SameTransaction(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Migrator().DropTable(&Log{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testUser{Name: "zhang"}).Error; err == nil {
+		t.Fatal("Create() should fail when audit_logs can not be written")
+	}
+	var count int64
+	db.Model(&testUser{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Create() should be rolled back with the audit log, got %d rows", count)
+	}
+}
+
+func TestRegister_DoesNotMigrate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable(&Log{}) {
+		t.Error("Register() should not create audit_logs, use Migrate")
+	}
+}
+
+// TestAudit_WriteSkipsCallbacks 审计记录直接写入，不经过 Create 的回调链
+func TestAudit_WriteSkipsCallbacks(t *testing.T) {
+	db := newTestDB(t)
+	var tables []string
+	db.Callback().Create().After("gorm:create").Register("test:tables", func(db *gorm.DB) {
+		tables = append(tables, db.Statement.Table)
+	})
+	if err := db.Create(&testUser{Name: "zhang"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&Log{}).Count(&count)
+	if count != 1 || len(tables) != 1 || tables[0] != "test_users" {
+		t.Errorf("audit_logs got %d rows, callbacks ran for %v", count, tables)
+	}
+}
+
+type testSecret struct {
+	ID    uint   `gorm:"primaryKey"`
+	Phone string `gorm:"size:128" secret:"true"`
+}
+
+// TestAudit_EncryptorTagName 没有指定 RedactTags 时使用加解密插件自定义的 tag 名称
+func TestAudit_EncryptorTagName(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := Register(db, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := callback.New(callback.Config{TagName: "secret"})
+	if err := e.Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Log{}, &testSecret{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testSecret{Phone: "18601774393"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var log Log
+	db.First(&log)
+	var changes map[string]Change
+	if err := json.Unmarshal([]byte(log.Changes), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if changes["phone"].New != Redacted {
+		t.Errorf("changes[phone] got = %+v, want %v", changes["phone"], Redacted)
+	}
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/callback"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// DefaultPrefix 缓存 key 的默认前缀
+const DefaultPrefix = "gorm:cache:"
+
+type skipKey struct{}
+
+// Skip 返回不使用缓存的 context，查询直接访问数据库，结果也不写入缓存
+func Skip(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipKey{}, true)
+}
+
+func skipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipKey{}).(bool)
+	return skip
+}
+
+// Config 查询缓存配置
+type Config struct {
+	// Store 为空时为 NewLRU(DefaultCapacity)
+	Store Store
+	// TTL 每个模型的缓存时间，key 为模型的结构体名称或表名。只有配置了 TTL 的模型会被缓存
+	TTL map[string]time.Duration
+	// Prefix 缓存 key 的前缀，多个服务共用一个 Redis 时用于区分，为空时为 DefaultPrefix
+	Prefix string
+}
+
+// cacher 查询缓存回调
+type cacher struct {
+	config  Config
+	counter uint64
+}
+
+// Register 注册查询缓存：替换 gorm:query，按 SQL 和参数缓存 TTL 中模型的查询结果；
+// 新增、更新、删除以及 Exec 修改表后使该表的缓存失效。
+// 带有加密或哈希字段的模型不使用缓存：加密字段在扫描阶段就已解密，缓存中会保存明文，命中时也不会产生字段读取审计。
+// 事务中的查询、Joins 查询、Raw 查询以及 Dest 不是模型的查询（Count、Pluck 等）不使用缓存。
+// 调用方事务中的修改在语句执行后即失效，提交前的并发查询可能重新缓存旧数据，直到 TTL 过期
+func Register(db *gorm.DB, config Config) error {
+	if config.Store == nil {
+		config.Store = NewLRU(DefaultCapacity)
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	c := &cacher{config: config}
+	if err := db.Callback().Query().Replace("gorm:query", c.query); err != nil {
+		return err
+	}
+	db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register("customer:cache_create", c.invalidate)
+	db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register("customer:cache_update", c.invalidate)
+	db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register("customer:cache_delete", c.invalidate)
+	db.Callback().Raw().After("gorm:raw").Register("customer:cache_raw", c.invalidate)
+	return nil
+}
+
+// ttlOf 返回模型的缓存时间，没有配置时返回 0
+func (c *cacher) ttlOf(db *gorm.DB) time.Duration {
+	if db.Statement.Schema == nil {
+		return 0
+	}
+	if ttl, ok := c.config.TTL[db.Statement.Schema.Name]; ok {
+		return ttl
+	}
+	return c.config.TTL[db.Statement.Schema.Table]
+}
+
+// cacheable 判断查询是否可以使用缓存
+func (c *cacher) cacheable(db *gorm.DB) bool {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.SQL.Len() > 0 || len(stmt.Joins) > 0 || skipped(stmt.Context) {
+		return false
+	}
+	if callback.HasEncryptedFields(db, stmt.Schema) {
+		return false
+	}
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return false
+	}
+	rv := stmt.ReflectValue
+	if !rv.IsValid() {
+		return false
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		rv = reflect.New(rv.Type().Elem()).Elem()
+	}
+	return reflect.Indirect(rv).Type() == stmt.Schema.ModelType
+}
+
+// query 命中缓存时直接解码结果，否则查询数据库并写入缓存
+func (c *cacher) query(db *gorm.DB) {
+	ttl := c.ttlOf(db)
+	if ttl <= 0 || !c.cacheable(db) {
+		callbacks.Query(db)
+		return
+	}
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	ctx := db.Statement.Context
+	key, err := c.key(db)
+	if err == nil {
+		var data []byte
+		if data, err = c.config.Store.Get(ctx, key); err == nil {
+			if err = c.decode(db, data); err == nil {
+				return
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		db.Logger.Warn(ctx, "cache get %s: %v", db.Statement.Table, err)
+	}
+
+	callbacks.Query(db)
+	if db.Error != nil || key == "" {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(db.Statement.Dest); err != nil {
+		db.Logger.Warn(ctx, "cache encode %s: %v", db.Statement.Table, err)
+		return
+	}
+	if err := c.config.Store.Set(ctx, key, buf.Bytes(), ttl); err != nil {
+		db.Logger.Warn(ctx, "cache set %s: %v", db.Statement.Table, err)
+	}
+}
+
+// decode 把缓存的结果解码到 Dest，解码前清空 Dest 避免保留旧值
+func (c *cacher) decode(db *gorm.DB, data []byte) error {
+	dest := reflect.ValueOf(db.Statement.Dest)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("cache: unsupported dest %T", db.Statement.Dest)
+	}
+	dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(db.Statement.Dest); err != nil {
+		return err
+	}
+	switch rv := reflect.Indirect(dest.Elem()); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		db.RowsAffected = int64(rv.Len())
+	default:
+		db.RowsAffected = 1
+	}
+	return nil
+}
+
+// key 返回查询的缓存 key：表的版本号加上 SQL 和参数的摘要，表失效后版本号变化，旧的缓存不再被读取
+func (c *cacher) key(db *gorm.DB) (string, error) {
+	version, err := c.version(db.Statement.Context, db.Statement.Table)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write([]byte(strings.Join(strings.Fields(db.Statement.SQL.String()), " ")))
+	for _, v := range db.Statement.Vars {
+		fmt.Fprintf(sum, "\x00%T:%v", v, reflect.Indirect(reflect.ValueOf(v)))
+	}
+	return c.config.Prefix + db.Statement.Table + ":" + version + ":" + hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (c *cacher) versionKey(table string) string {
+	return c.config.Prefix + "version:" + table
+}
+
+func (c *cacher) version(ctx context.Context, table string) (string, error) {
+	version, err := c.config.Store.Get(ctx, c.versionKey(table))
+	if errors.Is(err, ErrCacheMiss) {
+		return "0", nil
+	}
+	return string(version), err
+}
+
+// execTable 从 Exec 的 SQL 中找出修改的表
+var execTable = regexp.MustCompile("(?i)^\\s*(?:insert\\s+(?:ignore\\s+)?into|replace\\s+into|update|delete\\s+from)\\s+[`\"]?(\\w+)")
+
+// invalidate 修改成功后更新表的版本号，使表的缓存失效
+func (c *cacher) invalidate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	table := db.Statement.Table
+	if match := execTable.FindStringSubmatch(db.Statement.SQL.String()); table == "" && match != nil {
+		table = match[1]
+	}
+	if table == "" {
+		return
+	}
+	version := strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&c.counter, 1), 36)
+	if err := c.config.Store.Set(db.Statement.Context, c.versionKey(table), []byte(version), 0); err != nil {
+		db.Logger.Warn(db.Statement.Context, "cache invalidate %s: %v", table, err)
+	}
+}
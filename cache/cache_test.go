@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zhang1github2test/gorm-learning/callback"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:32"`
+	Age       uint8
+	CreatedAt *time.Time
+}
+
+type testGrade struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func newTestDB(t *testing.T) (*gorm.DB, *LRU) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}, &testGrade{}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewLRU(100)
+	if err := Register(db, Config{Store: store, TTL: map[string]time.Duration{"testUser": time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]testUser{{Name: "zhang", Age: 18}, {Name: "li", Age: 20}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, store
+}
+
+// changeBehindCache 绕过 GORM 直接修改数据库，缓存不会失效
+func changeBehindCache(t *testing.T, db *gorm.DB, query string) {
+	t.Helper()
+	sqlDB, _ := db.DB()
+	if _, err := sqlDB.Exec(query); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	db, _ := newTestDB(t)
+	first := func(ctx context.Context) string {
+		var user testUser
+		if err := db.WithContext(ctx).Where("age > ?", 10).First(&user, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user.Name
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		ctx    context.Context
+		want   string
+	}{
+		{name: "miss", change: func() {}, want: "zhang"},
+		{name: "hit", change: func() { changeBehindCache(t, db, "UPDATE test_users SET name = 'wang' WHERE id = 1") }, want: "zhang"},
+		{name: "skip", change: func() {}, ctx: Skip(context.Background()), want: "wang"},
+		{name: "update invalidates", change: func() { db.Model(&testUser{ID: 1}).Update("name", "zhao") }, want: "zhao"},
+		{name: "exec invalidates", change: func() { db.Exec("UPDATE test_users SET name = ? WHERE id = ?", "sun", 1) }, want: "sun"},
+		{name: "delete invalidates", change: func() {
+			changeBehindCache(t, db, "UPDATE test_users SET name = 'zhou' WHERE id = 1")
+			db.Delete(&testUser{}, 2)
+		}, want: "zhou"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if got := first(ctx); got != tt.want {
+				t.Errorf("First() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	var users []testUser
+	if err := db.Find(&users).Error; err != nil || len(users) != 1 {
+		t.Errorf("Find() got = %+v, err = %v", users, err)
+	}
+	if err := db.First(&testUser{}, 2).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("First() err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestCache_NotCached(t *testing.T) {
+	db, store := newTestDB(t)
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{name: "model without ttl", run: func() error { return db.Find(&[]testGrade{}).Error }},
+		{name: "count", run: func() error { var count int64; return db.Model(&testUser{}).Count(&count).Error }},
+		{name: "pluck", run: func() error { var names []string; return db.Model(&testUser{}).Pluck("name", &names).Error }},
+		{name: "raw", run: func() error { return db.Raw("SELECT * FROM test_users").Scan(&[]testUser{}).Error }},
+		{name: "transaction", run: func() error {
+			return db.Transaction(func(tx *gorm.DB) error { return tx.Find(&[]testUser{}).Error })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := store.Len()
+			if err := tt.run(); err != nil {
+				t.Fatal(err)
+			}
+			if store.Len() != before {
+				t.Errorf("query should not be cached, store got %d keys, want %d", store.Len(), before)
+			}
+		})
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRU(2)
+	_ = store.Set(ctx, "a", []byte("1"), 0)
+	_ = store.Set(ctx, "b", []byte("2"), 0)
+	_, _ = store.Get(ctx, "a")
+	_ = store.Set(ctx, "c", []byte("3"), 0)
+	_ = store.Set(ctx, "d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{key: "a", wantErr: ErrCacheMiss},
+		{key: "b", wantErr: ErrCacheMiss},
+		{key: "c", want: "3"},
+		{key: "d", wantErr: ErrCacheMiss},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := store.Get(ctx, tt.key)
+			if !errors.Is(err, tt.wantErr) || string(got) != tt.want {
+				t.Errorf("Get() got = %q, err = %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+type testStudent struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:32"`
+	Phone string `gorm:"size:128" encryption:"true"`
+}
+
+// auditSink 记录字段读取审计
+type auditSink struct {
+	events []callback.FieldAccess
+}
+
+func (s *auditSink) Record(ctx context.Context, events []callback.FieldAccess) {
+	s.events = append(s.events, events...)
+}
+
+// TestCache_EncryptedModel 带加密字段的模型不缓存，缓存中没有明文，每次读取都记录审计
+func TestCache_EncryptedModel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	sink := &auditSink{}
+	e, _ := callback.New(callback.Config{AuditSink: sink})
+	if err := e.Register(db, &testStudent{}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewLRU(100)
+	if err := Register(db, Config{Store: store, TTL: map[string]time.Duration{"testStudent": time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testStudent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testStudent{Name: "zhang", Phone: "18601774393"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	before := store.Len()
+	for i := 0; i < 2; i++ {
+		var student testStudent
+		if err := db.First(&student, 1).Error; err != nil || student.Phone != "18601774393" {
+			t.Fatalf("First() got = %+v, %v", student, err)
+		}
+	}
+	if store.Len() != before {
+		t.Errorf("encrypted model should not be cached, store got %d keys, want %d", store.Len(), before)
+	}
+	for elem := store.ll.Front(); elem != nil; elem = elem.Next() {
+		if entry := elem.Value.(*lruEntry); strings.Contains(string(entry.value), "18601774393") {
+			t.Errorf("store holds plaintext in %s", entry.key)
+		}
+	}
+	if len(sink.events) != 2 {
+		t.Errorf("audit events got = %+v, want 2", sink.events)
+	}
+}
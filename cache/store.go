@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss Store 中没有 key 或者已经过期
+var ErrCacheMiss = errors.New("cache: miss")
+
+// Store 缓存存储，接口与 Redis 的 GET/SET EX 对应，可以使用 Redis 等外部缓存实现
+type Store interface {
+	// Get 返回 key 的值，不存在时返回 ErrCacheMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set 设置 key 的值，ttl 为 0 时不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// DefaultCapacity NewLRU 的默认容量
+const DefaultCapacity = 1000
+
+// LRU 进程内的 LRU 缓存
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU 创建最多保存 capacity 个 key 的 LRU 缓存，capacity 小于等于 0 时为 DefaultCapacity
+func NewLRU(capacity int) *LRU {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &LRU{capacity: capacity, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, ErrCacheMiss
+	}
+	c.ll.MoveToFront(elem)
+	return entry.value, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.ll.MoveToFront(elem)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.capacity {
+		c.remove(c.ll.Back())
+	}
+	return nil
+}
+
+// Len 返回缓存中 key 的数量，包括已经过期但还没有被淘汰的 key
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry).key)
+}
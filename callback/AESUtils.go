@@ -12,6 +12,13 @@ import (
 
 var Key []byte
 
+var (
+	// ErrInvalidPadding 解密后的 PKCS7 填充不合法，通常是密钥错误或密文被篡改
+	ErrInvalidPadding = errors.New("invalid padding")
+	// ErrInvalidCipherTextSize 密文长度不是块大小的整数倍，或者不足 IV 加一个块
+	ErrInvalidCipherTextSize = errors.New("invalid ciphertext size")
+)
+
 // PKCS7Padding implements padding for AES block size (16 bytes)
 func PKCS7Padding(data []byte, blockSize int) []byte {
 	padding := blockSize - len(data)%blockSize
@@ -52,17 +59,23 @@ func AesEncrypt(plainText, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(cipherText), nil
 }
 
-// PKCS7UnPadding removes padding after decryption
+// PKCS7UnPadding removes padding after decryption. The padding size must be
+// between 1 and aes.BlockSize and every padding byte must equal the size
 func PKCS7UnPadding(data []byte) ([]byte, error) {
 	length := len(data)
-	if length == 0 {
-		return nil, errors.New("invalid ciphertext size")
+	if length == 0 || length%aes.BlockSize != 0 {
+		return nil, ErrInvalidCipherTextSize
 	}
 
 	// Get the value of the last byte which is the padding size
 	padding := int(data[length-1])
-	if padding > length {
-		return nil, errors.New("invalid padding size")
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrInvalidPadding
+	}
+	for _, b := range data[length-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidPadding
+		}
 	}
 
 	// Remove the padding bytes
@@ -77,9 +90,9 @@ func AesDecrypt(cipherText string, key []byte) (string, error) {
 		return "", err
 	}
 
-	// The IV is the first 16 bytes
-	if len(cipherData) < aes.BlockSize {
-		return "", errors.New("ciphertext too short")
+	// The IV is the first 16 bytes, followed by at least one whole block
+	if len(cipherData) < 2*aes.BlockSize || len(cipherData)%aes.BlockSize != 0 {
+		return "", ErrInvalidCipherTextSize
 	}
 	iv := cipherData[:aes.BlockSize]
 	cipherData = cipherData[aes.BlockSize:]
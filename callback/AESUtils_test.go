@@ -0,0 +1,132 @@
+package callback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"testing/quick"
+)
+
+func TestPKCS7UnPadding(t *testing.T) {
+	block := func(tail ...byte) []byte {
+		return append(bytes.Repeat([]byte{'a'}, aes.BlockSize-len(tail)), tail...)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "one", data: block(1), want: bytes.Repeat([]byte{'a'}, aes.BlockSize-1)},
+		{name: "full block", data: append(block(), bytes.Repeat([]byte{aes.BlockSize}, aes.BlockSize)...), want: block()},
+		{name: "empty", data: nil, wantErr: ErrInvalidCipherTextSize},
+		{name: "not block multiple", data: []byte{1}, wantErr: ErrInvalidCipherTextSize},
+		{name: "zero padding", data: block(0), wantErr: ErrInvalidPadding},
+		{name: "padding larger than block", data: block(17), wantErr: ErrInvalidPadding},
+		{name: "inconsistent padding", data: block(1, 3, 3), wantErr: ErrInvalidPadding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PKCS7UnPadding(tt.data)
+			if !errors.Is(err, tt.wantErr) || !bytes.Equal(got, tt.want) {
+				t.Errorf("PKCS7UnPadding() got = %q, err = %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAesDecrypt_Invalid(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name       string
+		cipherText string
+		wantErr    error
+	}{
+		{name: "iv only", cipherText: encode(make([]byte, aes.BlockSize)), wantErr: ErrInvalidCipherTextSize},
+		{name: "not block multiple", cipherText: encode(make([]byte, 2*aes.BlockSize+1)), wantErr: ErrInvalidCipherTextSize},
+		{name: "bad padding", cipherText: encode(make([]byte, 2*aes.BlockSize)), wantErr: ErrInvalidPadding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AesDecrypt(tt.cipherText, DATA_KEY); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AesDecrypt() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestAesRoundTrip 任意明文加密后都能解密回原文
+func TestAesRoundTrip(t *testing.T) {
+	roundTrip := func(plainText []byte) bool {
+		cipherText, err := AesEncrypt(append([]byte(nil), plainText...), DATA_KEY)
+		if err != nil {
+			return false
+		}
+		got, err := AesDecrypt(cipherText, DATA_KEY)
+		return err == nil && got == string(plainText)
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPKCS7RoundTrip 任意数据填充后都能去掉填充还原，填充后的长度是块大小的整数倍
+func TestPKCS7RoundTrip(t *testing.T) {
+	roundTrip := func(data []byte) bool {
+		padded := PKCS7Padding(append([]byte(nil), data...), aes.BlockSize)
+		if len(padded)%aes.BlockSize != 0 || len(padded) <= len(data) {
+			return false
+		}
+		got, err := PKCS7UnPadding(padded)
+		return err == nil && bytes.Equal(got, data)
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzAesDecrypt(f *testing.F) {
+	valid, _ := AesEncrypt([]byte("18601774393"), DATA_KEY)
+	f.Add(valid)
+	f.Add("")
+	f.Add(base64.StdEncoding.EncodeToString(make([]byte, 2*aes.BlockSize+3)))
+	f.Fuzz(func(t *testing.T, cipherText string) {
+		// 任意输入都只能返回错误，不能 panic
+		_, _ = AesDecrypt(cipherText, DATA_KEY)
+	})
+}
+
+func FuzzPKCS7UnPadding(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(bytes.Repeat([]byte{aes.BlockSize}, aes.BlockSize))
+	f.Add(append(bytes.Repeat([]byte{'a'}, aes.BlockSize-1), 0))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got, err := PKCS7UnPadding(data)
+		if err != nil {
+			return
+		}
+		// 去掉的填充必须是 1 到 16 个值等于填充长度的字节
+		padding := len(data) - len(got)
+		if padding < 1 || padding > aes.BlockSize || !bytes.Equal(data[len(got):], bytes.Repeat([]byte{byte(padding)}, padding)) {
+			t.Errorf("PKCS7UnPadding(%v) accepted invalid padding", data)
+		}
+	})
+}
+
+func FuzzAesRoundTrip(f *testing.F) {
+	f.Add([]byte(""))
+	f.Add([]byte("18601774393"))
+	f.Add(bytes.Repeat([]byte{aes.BlockSize}, aes.BlockSize))
+	f.Fuzz(func(t *testing.T, plainText []byte) {
+		cipherText, err := AesEncrypt(append([]byte(nil), plainText...), DATA_KEY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := AesDecrypt(cipherText, DATA_KEY)
+		if err != nil || got != string(plainText) {
+			t.Errorf("AesDecrypt() got = %q, err = %v, want %q", got, err, plainText)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// FieldAccess 一次加密字段的读取（解密）记录
+type FieldAccess struct {
+	// Model 模型名称，例如 Student
+	Model string
+	Table string
+	// PrimaryKey 记录的主键，联合主键以逗号分隔；Pluck 等没有查询主键的读取为空
+	PrimaryKey string
+	// Field 字段的列名
+	Field string
+	// Actor 读取者，见 WithActor
+	Actor      string
+	AccessedAt time.Time
+}
+
+// AuditSink 字段访问审计事件的接收者，通过 Config.AuditSink 配置。
+// Record 在执行查询的 goroutine 中同步调用，实现应尽快返回（例如先放入缓冲区再异步写入）
+type AuditSink interface {
+	Record(ctx context.Context, events []FieldAccess)
+}
+
+type actorKey struct{}
+
+// WithActor 在 context 中设置当前的读取者（用户 ID、服务名等），通过 db.WithContext(ctx) 传给查询
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext 返回 WithActor 设置的读取者
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// accessLog 一次查询中解密过的字段。扫描单个字段时记录的主键可能还没有赋值，
+// 因此先记录字段和所在的记录，查询结束后再读取主键并上报
+type accessLog struct {
+	mu      sync.Mutex
+	entries []accessEntry
+}
+
+type accessEntry struct {
+	field *schema.Field
+	row   reflect.Value
+	// primaryKey 没有 row 时（Pluck、map）直接记录的主键
+	primaryKey string
+}
+
+type accessLogKey struct{}
+
+// beginAudit 查询执行前在 Statement.Context 中放入 accessLog，由 flushAudit 在查询结束后上报
+func (e *Encryptor) beginAudit(db *gorm.DB) {
+	if e.config.AuditSink != nil && db.Error == nil {
+		db.Statement.Context = context.WithValue(db.Statement.Context, accessLogKey{}, &accessLog{})
+	}
+}
+
+// flushAudit 读取记录的主键并把本次查询的访问事件交给 AuditSink
+func (e *Encryptor) flushAudit(db *gorm.DB) {
+	log, ok := db.Statement.Context.Value(accessLogKey{}).(*accessLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	entries := log.entries
+	log.entries = nil
+	log.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	ctx := db.Statement.Context
+	events := make([]FieldAccess, len(entries))
+	for i, entry := range entries {
+		primaryKey := entry.primaryKey
+		if entry.row.IsValid() {
+			primaryKey = primaryKeyOf(ctx, entry.field.Schema, entry.row)
+		}
+		events[i] = newFieldAccess(ctx, entry.field, primaryKey)
+	}
+	e.config.AuditSink.Record(ctx, events)
+}
+
+// recordAccess 记录一次字段解密。查询回调链中先放入 accessLog，
+// Raw().Scan()、Rows() 等没有结束回调的读取立即上报，此时主键按扫描到该字段时的值记录
+func (e *Encryptor) recordAccess(ctx context.Context, field *schema.Field, row reflect.Value, primaryKey string) {
+	if e.config.AuditSink == nil {
+		return
+	}
+	if log, ok := ctx.Value(accessLogKey{}).(*accessLog); ok {
+		log.mu.Lock()
+		log.entries = append(log.entries, accessEntry{field: field, row: row, primaryKey: primaryKey})
+		log.mu.Unlock()
+		return
+	}
+	if row.IsValid() {
+		primaryKey = primaryKeyOf(ctx, field.Schema, row)
+	}
+	e.config.AuditSink.Record(ctx, []FieldAccess{newFieldAccess(ctx, field, primaryKey)})
+}
+
+func newFieldAccess(ctx context.Context, field *schema.Field, primaryKey string) FieldAccess {
+	return FieldAccess{
+		Model:      field.Schema.Name,
+		Table:      field.Schema.Table,
+		PrimaryKey: primaryKey,
+		Field:      field.DBName,
+		Actor:      ActorFromContext(ctx),
+		AccessedAt: time.Now(),
+	}
+}
+
+// primaryKeyOf 读取记录的主键，主键为零值时返回空字符串
+func primaryKeyOf(ctx context.Context, sch *schema.Schema, row reflect.Value) string {
+	values := make([]string, 0, len(sch.PrimaryFields))
+	for _, field := range sch.PrimaryFields {
+		value, zero := field.ValueOf(ctx, row)
+		if zero {
+			return ""
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
+
+// primaryKeyOfMap 读取 map 结果中的主键，没有查询主键列时返回空字符串
+func primaryKeyOfMap(sch *schema.Schema, m map[string]interface{}) string {
+	values := make([]string, 0, len(sch.PrimaryFields))
+	for _, field := range sch.PrimaryFields {
+		value, ok := m[field.DBName]
+		if !ok || value == nil {
+			return ""
+		}
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
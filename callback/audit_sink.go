@@ -0,0 +1,166 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// AuditFieldAccess audit_field_access 表的记录，由 TableAuditSink 写入
+type AuditFieldAccess struct {
+	ID         uint      `gorm:"primaryKey"`
+	Model      string    `gorm:"size:64"`
+	Table      string    `gorm:"column:table_name;size:64;index:idx_audit_field_access_row"`
+	PrimaryKey string    `gorm:"size:128;index:idx_audit_field_access_row"`
+	Field      string    `gorm:"size:64"`
+	Actor      string    `gorm:"size:128;index"`
+	AccessedAt time.Time `gorm:"index"`
+}
+
+// TableName 审计表名
+func (AuditFieldAccess) TableName() string {
+	return "audit_field_access"
+}
+
+// TableAuditSink 将字段访问记录批量写入 audit_field_access 表：Record 只放入缓冲区，
+// 缓冲区达到 batchSize 或每隔 interval 由后台 goroutine 写入，程序退出前需要调用 Close 写入剩余的记录
+type TableAuditSink struct {
+	db        *gorm.DB
+	batchSize int
+
+	mu      sync.Mutex
+	pending []AuditFieldAccess
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// MigrateAuditSink 创建或更新 audit_field_access 表，部署时执行一次，NewTableAuditSink 不会建表
+func MigrateAuditSink(db *gorm.DB) error {
+	return db.AutoMigrate(&AuditFieldAccess{})
+}
+
+// NewTableAuditSink 启动后台写入，表需要先通过 MigrateAuditSink 创建。db 为写入审计表使用的连接，可以与业务库不同
+func NewTableAuditSink(db *gorm.DB, batchSize int, interval time.Duration) (*TableAuditSink, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	sink := &TableAuditSink{
+		db:        db.Session(&gorm.Session{NewDB: true, Context: context.Background()}),
+		batchSize: batchSize,
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	sink.wg.Add(1)
+	go sink.run(interval)
+	return sink, nil
+}
+
+// Record implements AuditSink
+func (s *TableAuditSink) Record(ctx context.Context, events []FieldAccess) {
+	s.mu.Lock()
+	for _, event := range events {
+		s.pending = append(s.pending, AuditFieldAccess{
+			Model:      event.Model,
+			Table:      event.Table,
+			PrimaryKey: event.PrimaryKey,
+			Field:      event.Field,
+			Actor:      event.Actor,
+			AccessedAt: event.AccessedAt,
+		})
+	}
+	full := len(s.pending) >= s.batchSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close 停止后台写入并写入缓冲区中剩余的记录
+func (s *TableAuditSink) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return s.write()
+}
+
+func (s *TableAuditSink) run(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		case <-s.done:
+			return
+		}
+		if err := s.write(); err != nil {
+			s.db.Logger.Error(context.Background(), "audit: write field access failed: %v", err)
+		}
+	}
+}
+
+// write 按 batchSize 分批写入缓冲区中的记录，写入失败的记录会被丢弃，避免缓冲区无限增长
+func (s *TableAuditSink) write() error {
+	s.mu.Lock()
+	records := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for len(records) > 0 {
+		n := s.batchSize
+		if n > len(records) {
+			n = len(records)
+		}
+		if err := s.insert(records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// insert 直接在连接池上执行 INSERT，不经过 Create 的回调链，审计记录不会再被加解密、审计、拦截、指标、追踪和慢查询等插件处理
+func (s *TableAuditSink) insert(records []AuditFieldAccess) error {
+	db := s.db
+	stmt := &gorm.Statement{
+		DB:       db,
+		ConnPool: db.Statement.ConnPool,
+		Context:  db.Statement.Context,
+		Clauses:  map[string]clause.Clause{},
+		Dest:     records,
+	}
+	if err := stmt.Parse(&AuditFieldAccess{}); err != nil {
+		return fmt.Errorf("audit: write audit_field_access: %w", err)
+	}
+	stmt.ReflectValue = reflect.ValueOf(records)
+	stmt.AddClause(clause.Insert{})
+	stmt.AddClause(callbacks.ConvertToCreateValues(stmt))
+	stmt.Build("INSERT", "VALUES")
+
+	begin := time.Now()
+	result, err := stmt.ConnPool.ExecContext(stmt.Context, stmt.SQL.String(), stmt.Vars...)
+	db.Logger.Trace(stmt.Context, begin, func() (string, int64) {
+		var rows int64
+		if result != nil {
+			rows, _ = result.RowsAffected()
+		}
+		return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...), rows
+	}, err)
+	if err != nil {
+		return fmt.Errorf("audit: write audit_field_access: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryAuditSink 在内存中记录审计事件
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []FieldAccess
+}
+
+func (s *memoryAuditSink) Record(ctx context.Context, events []FieldAccess) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+}
+
+// take 返回并清空已记录的事件，格式为 表.列#主键@读取者，按字典序排序
+func (s *memoryAuditSink) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]string, len(s.events))
+	for i, event := range s.events {
+		result[i] = fmt.Sprintf("%s.%s#%s@%s", event.Table, event.Field, event.PrimaryKey, event.Actor)
+	}
+	s.events = nil
+	sort.Strings(result)
+	return result
+}
+
+func TestEncrypt_Audit(t *testing.T) {
+	sink := &memoryAuditSink{}
+	e, _ := New(Config{FailOnDecryptError: true, AuditSink: sink})
+	db := newEncryptorDB(t, e, &testAccount{})
+	for _, name := range []string{"a", "b"} {
+		if err := db.Create(&testAccount{Name: name, Phone: "186" + name, Email: name + "@163.com"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.take()
+
+	ctx := WithActor(context.Background(), "admin")
+	tests := []struct {
+		name string
+		run  func() error
+		want []string
+	}{
+		{name: "find", run: func() error {
+			// 主键列在加密列之后扫描，也能记录主键
+			return db.WithContext(ctx).Select("phone", "id").Order("id").Find(&[]testAccount{}).Error
+		}, want: []string{"test_accounts.phone#1@admin", "test_accounts.phone#2@admin"}},
+		{name: "first", run: func() error {
+			return db.First(&testAccount{}, 2).Error
+		}, want: []string{"test_accounts.email#2@", "test_accounts.phone#2@"}},
+		{name: "pluck", run: func() error {
+			var phones []string
+			return db.WithContext(ctx).Model(&testAccount{}).Pluck("phone", &phones).Error
+		}, want: []string{"test_accounts.phone#@admin", "test_accounts.phone#@admin"}},
+		{name: "rawScan", run: func() error {
+			var account testAccount
+			return db.WithContext(ctx).Raw("SELECT id, phone FROM test_accounts WHERE id = ?", 1).Scan(&account).Error
+		}, want: []string{"test_accounts.phone#1@admin"}},
+		{name: "notEncrypted", run: func() error {
+			var names []string
+			return db.Model(&testAccount{}).Pluck("name", &names).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := sink.take(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("audit events got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableAuditSink(t *testing.T) {
+	db := newTestDB(t)
+	if err := MigrateAuditSink(db); err != nil {
+		t.Fatal(err)
+	}
+	// 审计记录直接写入，不经过 Create 的回调链
+	var creates int
+	if err := db.Callback().Create().Before("gorm:create").Register("test:count", func(*gorm.DB) {
+		creates++
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewTableAuditSink(db, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []FieldAccess{
+		{Model: "Student", Table: "students", PrimaryKey: "1", Field: "phone", Actor: "admin", AccessedAt: time.Now()},
+		{Model: "Student", Table: "students", PrimaryKey: "2", Field: "phone", Actor: "admin", AccessedAt: time.Now()},
+		{Model: "Student", Table: "students", PrimaryKey: "3", Field: "phone", AccessedAt: time.Now()},
+	}
+	sink.Record(context.Background(), events)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []AuditFieldAccess
+	if err := db.Order("id").Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Table != "students" || got[1].PrimaryKey != "2" || got[2].Actor != "" {
+		t.Errorf("audit_field_access got = %+v", got)
+	}
+	if creates != 0 {
+		t.Errorf("create callbacks got = %d, want 0", creates)
+	}
+}
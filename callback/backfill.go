@@ -0,0 +1,320 @@
+package callback
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// BackfillOptions 回填加密的参数
+type BackfillOptions struct {
+	// Fields 需要回填的字段名或列名，为空时处理模型的全部加密字段
+	Fields []string
+	// BatchSize 每批处理的记录数，每批在一个事务中提交，默认 100
+	BatchSize int
+	// After 只处理主键大于 After 的记录，用于中断后从上次提交的位置继续
+	After interface{}
+	// Verify 每批写入后在同一事务中重新读取并解密，与原值不一致时回滚该批次并返回错误
+	Verify bool
+	// Progress 每批提交后调用，result 为截至当前的累计结果
+	Progress func(result BackfillResult)
+	// PlaintextTokens 允许在 Fields 中指定 mode:token 字段，并把这些字段的值全部当作明文生成令牌。
+	// 令牌无法与明文区分，只能对尚未迁移的列执行一次：中断后必须用 LastID 继续，重复执行会把令牌再加密一次
+	PlaintextTokens bool
+}
+
+// BackfillResult 回填的累计结果
+type BackfillResult struct {
+	// Scanned 读取的记录数
+	Scanned int64
+	// Updated 改写的记录数
+	Updated int64
+	// LastID 最后一个已提交批次的最大主键，作为 BackfillOptions.After 可以继续执行
+	LastID interface{}
+}
+
+// Backfill 加密模型中已有的明文数据：按主键分批读取原始值，明文加密（哈希字段写入哈希值），已经是信封密文的值跳过。
+// 没有信封前缀的值都按明文处理，列中还有旧格式密文时需要先执行 MigrateLegacy，否则旧密文会被再次加密。
+// 通过 Rows() 读取并按表名更新，不经过加解密回调。每批在一个事务中提交，重复执行是安全的，
+// 中断后可以用 BackfillResult.LastID 作为 After 继续
+func (e *Encryptor) Backfill(db *gorm.DB, model interface{}, opts BackfillOptions) (BackfillResult, error) {
+	return e.rewrite(db, model, opts, FormatPlain)
+}
+
+// Backfill 见 Encryptor.Backfill
+func Backfill(db *gorm.DB, model interface{}, opts BackfillOptions) (BackfillResult, error) {
+	return encryptorOf(db).Backfill(db, model, opts)
+}
+
+// MigrateLegacy 将模型中旧格式（无前缀 base64）的密文改写为信封格式，明文保持不变，返回改写的行数。见 Backfill。
+// 旧格式通过能否用 DefaultKeyID 的主密钥解密来识别，形如 base64 的明文可能被误判，只应在确认列中存在旧密文时显式执行
+func (e *Encryptor) MigrateLegacy(db *gorm.DB, model interface{}, batchSize int) (int64, error) {
+	result, err := e.rewrite(db, model, BackfillOptions{BatchSize: batchSize}, FormatLegacy)
+	return result.Updated, err
+}
+
+// MigrateLegacy 见 Encryptor.MigrateLegacy
+func MigrateLegacy(db *gorm.DB, model interface{}, batchSize int) (int64, error) {
+	return encryptorOf(db).MigrateLegacy(db, model, batchSize)
+}
+
+// backfillRow 一条需要改写的记录
+type backfillRow struct {
+	id     interface{}
+	values map[string]interface{}
+	// originals 改写前的明文，key 为列名，用于 Verify
+	originals map[string]string
+}
+
+// rewrite 分批改写格式为 formats 之一的加密列
+func (e *Encryptor) rewrite(db *gorm.DB, model interface{}, opts BackfillOptions, formats ...Format) (BackfillResult, error) {
+	result := BackfillResult{LastID: opts.After}
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return result, err
+	}
+	fields, err := e.backfillFields(sch, opts.Fields, opts.PlaintextTokens)
+	if err != nil || len(fields) == 0 {
+		return result, err
+	}
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return result, errors.New("encryption: model has no primary key")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	columns := []string{pk.DBName}
+	for _, ef := range fields {
+		columns = append(columns, ef.Field.DBName)
+	}
+	subjects, err := backfillSubjects(fields, pk)
+	if err != nil {
+		return result, err
+	}
+	for _, field := range subjects {
+		columns = append(columns, field.DBName)
+	}
+	for {
+		var count int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			query := tx.Table(sch.Table).Select(columns).Order(pk.DBName).Limit(opts.BatchSize)
+			if result.LastID != nil {
+				query = query.Where(clause.Gt{Column: clause.Column{Name: pk.DBName}, Value: result.LastID})
+			}
+			rows, lastID, err := e.readBackfillRows(query, fields, subjects, formats)
+			if err != nil {
+				return err
+			}
+			count = rows.count
+
+			for _, row := range rows.pending {
+				err := tx.Table(sch.Table).Where(clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: row.id}).UpdateColumns(row.values).Error
+				if err != nil {
+					return err
+				}
+			}
+			if opts.Verify && len(rows.pending) > 0 {
+				if err := e.verifyBackfill(tx, sch, pk, fields, rows.pending); err != nil {
+					return err
+				}
+			}
+			result.Scanned += int64(count)
+			result.Updated += int64(len(rows.pending))
+			if lastID != nil {
+				result.LastID = lastID
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		if opts.Progress != nil && count > 0 {
+			opts.Progress(result)
+		}
+		if count < opts.BatchSize {
+			return result, nil
+		}
+	}
+}
+
+// backfillFields 返回需要回填的加密字段，names 为空时返回除令牌模式外的全部加密字段，
+// 令牌模式的字段只有在 names 中指定且 plaintextTokens 为 true 时返回
+func (e *Encryptor) backfillFields(sch *schema.Schema, names []string, plaintextTokens bool) ([]encryptedField, error) {
+	var fields []encryptedField
+	if len(names) == 0 {
+		// 令牌无法与明文区分，重复执行会再次加密，全部字段时跳过令牌字段
+		for _, ef := range e.prepareSchema(sch) {
+			if ef.Options.Mode != ModeToken {
+				fields = append(fields, ef)
+			}
+		}
+		return fields, nil
+	}
+	for _, name := range names {
+		ef, ok := e.encryptedFieldOf(sch, name)
+		if !ok {
+			return nil, fmt.Errorf("encryption: %s.%s is not an encrypted field", sch.Name, name)
+		}
+		if ef.Options.Mode == ModeToken && !plaintextTokens {
+			return nil, fmt.Errorf("encryption: %s.%s uses mode:token, tokens can not be told apart from plaintext, set PlaintextTokens to tokenize every value once", sch.Name, name)
+		}
+		fields = append(fields, ef)
+	}
+	return fields, nil
+}
+
+// backfillSubjects 返回 mode:subject 字段除主键外需要额外读取的主体字段
+func backfillSubjects(fields []encryptedField, pk *schema.Field) ([]*schema.Field, error) {
+	var subjects []*schema.Field
+	for _, ef := range fields {
+		if ef.Options.Mode != ModeSubject {
+			continue
+		}
+		field, err := subjectField(ef)
+		if err != nil {
+			return nil, err
+		}
+		if field != pk && subjectIndex(subjects, field) < 0 {
+			subjects = append(subjects, field)
+		}
+	}
+	return subjects, nil
+}
+
+func subjectIndex(subjects []*schema.Field, field *schema.Field) int {
+	for i, f := range subjects {
+		if f == field {
+			return i
+		}
+	}
+	return -1
+}
+
+type backfillBatch struct {
+	count   int
+	pending []backfillRow
+}
+
+// readBackfillRows 读取一批记录并加密其中格式为 formats 之一的值。先读完整批再更新，避免在单连接的数据库上读写互相阻塞
+// subjects 为 mode:subject 字段需要额外读取的主体字段，见 backfillSubjects
+func (e *Encryptor) readBackfillRows(query *gorm.DB, fields []encryptedField, subjects []*schema.Field, formats []Format) (batch backfillBatch, lastID interface{}, err error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return batch, nil, err
+	}
+	defer rows.Close()
+
+	ctx := query.Statement.Context
+	for rows.Next() {
+		var id interface{}
+		values := make([]interface{}, len(fields)+1+len(subjects))
+		values[0] = &id
+		for i := range fields {
+			values[i+1] = new(sql.NullString)
+		}
+		subjectValues := values[len(fields)+1:]
+		for i := range subjects {
+			subjectValues[i] = new(interface{})
+		}
+		if err := rows.Scan(values...); err != nil {
+			return batch, nil, err
+		}
+		batch.count++
+		lastID = id
+
+		row := backfillRow{id: id, values: map[string]interface{}{}, originals: map[string]string{}}
+		keys := newRowKeys(fields[0].Field.Schema.Table)
+		for i, ef := range fields {
+			value := values[i+1].(*sql.NullString)
+			if !value.Valid {
+				continue
+			}
+			original := value.String
+			format := DetectFormat(original, ef.Options.Mode)
+			if format == FormatPlain && hasFormat(FormatLegacy, formats) {
+				if plainText, err := e.decryptLegacy(ctx, ef.Options.Mode, original); err == nil {
+					format, original = FormatLegacy, plainText
+				}
+			}
+			if !hasFormat(format, formats) {
+				continue
+			}
+			if ef.Options.Mode == ModeSubject {
+				subject := id
+				if field, _ := subjectField(ef); field != nil {
+					if i := subjectIndex(subjects, field); i >= 0 {
+						subject = *subjectValues[i].(*interface{})
+					}
+				}
+				if keys.subject, err = subjectIDOf(subject); err != nil {
+					return batch, nil, fmt.Errorf("encryption: backfill %s.%s of %v: %w", ef.Field.Schema.Table, ef.Field.DBName, id, err)
+				}
+			}
+			cipherText, _, err := e.sealValue(ctx, ef.Options, original, keys)
+			if err != nil {
+				return batch, nil, err
+			}
+			row.values[ef.Field.DBName] = cipherText
+			row.originals[ef.Field.DBName] = original
+		}
+		if len(row.values) > 0 {
+			batch.pending = append(batch.pending, row)
+		}
+	}
+	return batch, lastID, rows.Err()
+}
+
+// verifyBackfill 重新读取本批改写的记录，解密后与改写前的明文比较，哈希字段校验哈希值
+func (e *Encryptor) verifyBackfill(tx *gorm.DB, sch *schema.Schema, pk *schema.Field, fields []encryptedField, pending []backfillRow) error {
+	ctx := tx.Statement.Context
+	columns := make([]string, len(fields))
+	for i, ef := range fields {
+		columns[i] = ef.Field.DBName
+	}
+	for _, row := range pending {
+		values := make([]interface{}, len(fields))
+		for i := range fields {
+			values[i] = new(sql.NullString)
+		}
+		err := tx.Table(sch.Table).Select(columns).Where(clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: row.id}).Row().Scan(values...)
+		if err != nil {
+			return err
+		}
+		for i, ef := range fields {
+			original, ok := row.originals[ef.Field.DBName]
+			if !ok {
+				continue
+			}
+			stored := values[i].(*sql.NullString).String
+			if ef.Options.Mode == ModeHash {
+				if ok, err := verifyHash(stored, original); err != nil || !ok {
+					return fmt.Errorf("encryption: verify %s.%s of %v: hash does not match", sch.Table, ef.Field.DBName, row.id)
+				}
+				continue
+			}
+			plainText, err := e.decryptValue(ctx, ef.Options, stored)
+			if err != nil {
+				return fmt.Errorf("encryption: verify %s.%s of %v: %w", sch.Table, ef.Field.DBName, row.id, err)
+			}
+			if plainText != original {
+				return fmt.Errorf("encryption: verify %s.%s of %v: decrypted value does not match", sch.Table, ef.Field.DBName, row.id)
+			}
+		}
+	}
+	return nil
+}
+
+func hasFormat(format Format, formats []Format) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package callback
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBackfill(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprint(i)
+		if err := db.Exec("INSERT INTO test_accounts (id, name, phone, email) VALUES (?, ?, ?, ?)", i, name, "186"+name, name+"@163.com").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已经加密的记录保持不变
+	encrypted := testAccount{ID: 6, Name: "6", Phone: "1866", Email: "6@163.com"}
+	if err := db.Create(&encrypted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		opts        BackfillOptions
+		wantUpdated int64
+		wantLastID  interface{}
+		wantBatches int
+	}{
+		{name: "resume", opts: BackfillOptions{Fields: []string{"phone"}, BatchSize: 2, After: int64(3), Verify: true}, wantUpdated: 2, wantLastID: int64(6), wantBatches: 2},
+		{name: "all", opts: BackfillOptions{Fields: []string{"Phone", "email"}, BatchSize: 2, Verify: true}, wantUpdated: 5, wantLastID: int64(6), wantBatches: 3},
+		{name: "idempotent", opts: BackfillOptions{BatchSize: 10}, wantUpdated: 0, wantLastID: int64(6), wantBatches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches int
+			tt.opts.Progress = func(BackfillResult) { batches++ }
+			got, err := Backfill(db, &testAccount{}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Updated != tt.wantUpdated || got.LastID != tt.wantLastID || batches != tt.wantBatches {
+				t.Errorf("Backfill() got = %+v with %d batches, want updated %v, last id %v, %d batches", got, batches, tt.wantUpdated, tt.wantLastID, tt.wantBatches)
+			}
+		})
+	}
+
+	var raws []string
+	db.Raw("SELECT phone FROM test_accounts UNION ALL SELECT email FROM test_accounts").Scan(&raws)
+	for _, raw := range raws {
+		if !strings.HasPrefix(raw, "enc:1:") {
+			t.Errorf("value is not encrypted: %v", raw)
+		}
+	}
+	var accounts []testAccount
+	if err := db.Order("id").Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if account.Phone != "186"+account.Name || account.Email != account.Name+"@163.com" {
+			t.Errorf("Find() got = %+v", account)
+		}
+	}
+
+	if _, err := Backfill(db, &testAccount{}, BackfillOptions{Fields: []string{"name"}}); err == nil {
+		t.Errorf("Backfill() on a plain field should fail")
+	}
+}
@@ -0,0 +1,95 @@
+package callback
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const benchmarkRows = 10000
+
+// reflectDecrypt 重构前的解密方式：每行都遍历 reflect.Type.NumField() 并重新解析 struct tag，仅作为基准对比
+func reflectDecrypt(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	rv := db.Statement.ReflectValue
+	for i := 0; i < rv.Len(); i++ {
+		row := reflect.Indirect(rv.Index(i))
+		rowType := row.Type()
+		for j := 0; j < rowType.NumField(); j++ {
+			if opts, ok := defaultEncryptor.parseTag(rowType.Field(j).Tag); ok {
+				plainText, err := defaultEncryptor.decryptValue(db.Statement.Context, opts, row.Field(j).String())
+				if err != nil {
+					db.AddError(err)
+				}
+				row.Field(j).SetString(plainText)
+			}
+		}
+	}
+}
+
+func openBenchmarkDB(b *testing.B, path string) *gorm.DB {
+	b.Helper()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// BenchmarkFind10k 对比 10000 行 Find 的吞吐：reflect 为重构前逐行反射，schema 为按 schema 缓存加密字段并在扫描时解密
+func BenchmarkFind10k(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "bench.db")
+	seed := openBenchmarkDB(b, path)
+	if err := Register(seed); err != nil {
+		b.Fatal(err)
+	}
+	if err := seed.AutoMigrate(&testAccount{}); err != nil {
+		b.Fatal(err)
+	}
+	accounts := make([]testAccount, benchmarkRows)
+	for i := range accounts {
+		accounts[i] = testAccount{Name: "zhangshenglu", Phone: "18601774393", Email: fmt.Sprintf("%d@163.com", i)}
+	}
+	if err := seed.CreateInBatches(&accounts, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		register func(db *gorm.DB) error
+	}{
+		{name: "reflect", register: func(db *gorm.DB) error {
+			return db.Callback().Query().After("gorm:after_query").Register("bench:reflect_decrypt", reflectDecrypt)
+		}},
+		{name: "schema", register: func(db *gorm.DB) error {
+			return Register(db)
+		}},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db := openBenchmarkDB(b, path)
+			if err := tt.register(db); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var got []testAccount
+				if err := db.Find(&got).Error; err != nil {
+					b.Fatal(err)
+				}
+				if len(got) != benchmarkRows || got[0].Phone != "18601774393" {
+					b.Fatalf("Find() got %d rows, phone %v", len(got), got[0].Phone)
+				}
+			}
+			b.ReportMetric(float64(b.N*benchmarkRows)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
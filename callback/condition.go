@@ -0,0 +1,108 @@
+package callback
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// EncryptConditions 将 WHERE 中针对 mode:deterministic、mode:token 字段的等值条件参数替换为密文，
+// 使 db.Where(&model.Student{Phone: "186..."}) 或 map 条件可以直接匹配密文列。
+// 字符串条件（如 Where("phone = ?", phone)）无法识别列名，需要调用方使用 EncryptDeterministic 自行加密参数
+func (e *Encryptor) EncryptConditions(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	c, ok := db.Statement.Clauses["WHERE"]
+	if !ok {
+		return
+	}
+	where, ok := c.Expression.(clause.Where)
+	if !ok {
+		return
+	}
+
+	exprs := make([]clause.Expression, len(where.Exprs))
+	for i, expr := range where.Exprs {
+		exprs[i] = e.encryptExpression(db, db.Statement.Schema, expr)
+	}
+	where.Exprs = exprs
+	c.Expression = where
+	db.Statement.Clauses["WHERE"] = c
+}
+
+// encryptExpression 递归处理条件表达式，只替换确定性加密字段的等值/IN 条件
+func (e *Encryptor) encryptExpression(db *gorm.DB, sch *schema.Schema, expr clause.Expression) clause.Expression {
+	switch cond := expr.(type) {
+	case clause.Eq:
+		if opts, ok := e.deterministicColumn(sch, cond.Column); ok {
+			cond.Value = e.encryptConditionValue(db, opts, cond.Value)
+		}
+		return cond
+	case clause.Neq:
+		if opts, ok := e.deterministicColumn(sch, cond.Column); ok {
+			cond.Value = e.encryptConditionValue(db, opts, cond.Value)
+		}
+		return cond
+	case clause.IN:
+		if opts, ok := e.deterministicColumn(sch, cond.Column); ok {
+			values := make([]interface{}, len(cond.Values))
+			for i, v := range cond.Values {
+				values[i] = e.encryptConditionValue(db, opts, v)
+			}
+			cond.Values = values
+		}
+		return cond
+	case clause.AndConditions:
+		cond.Exprs = e.encryptExpressions(db, sch, cond.Exprs)
+		return cond
+	case clause.OrConditions:
+		cond.Exprs = e.encryptExpressions(db, sch, cond.Exprs)
+		return cond
+	case clause.NotConditions:
+		cond.Exprs = e.encryptExpressions(db, sch, cond.Exprs)
+		return cond
+	}
+	return expr
+}
+
+func (e *Encryptor) encryptExpressions(db *gorm.DB, sch *schema.Schema, exprs []clause.Expression) []clause.Expression {
+	result := make([]clause.Expression, len(exprs))
+	for i, expr := range exprs {
+		result[i] = e.encryptExpression(db, sch, expr)
+	}
+	return result
+}
+
+// deterministicColumn 判断条件中的列是否为确定性加密字段（mode:deterministic 或 mode:token）
+func (e *Encryptor) deterministicColumn(sch *schema.Schema, column interface{}) (fieldOptions, bool) {
+	var name string
+	switch c := column.(type) {
+	case string:
+		name = c
+	case clause.Column:
+		if c.Raw || (c.Table != "" && c.Table != clause.CurrentTable && c.Table != sch.Table) {
+			return fieldOptions{}, false
+		}
+		name = c.Name
+	default:
+		return fieldOptions{}, false
+	}
+
+	ef, ok := e.encryptedFieldOf(sch, name)
+	return ef.Options, ok && (ef.Options.Mode == ModeDeterministic || ef.Options.Mode == ModeToken)
+}
+
+// encryptConditionValue 加密字符串类型的条件参数，已经是信封密文的参数和其他类型原样返回
+func (e *Encryptor) encryptConditionValue(db *gorm.DB, opts fieldOptions, value interface{}) interface{} {
+	plainText, ok := value.(string)
+	if !ok || IsEncrypted(plainText) {
+		return value
+	}
+	cipherText, err := e.encryptValue(db.Statement.Context, opts, plainText, nil)
+	if err != nil {
+		db.AddError(err)
+		return value
+	}
+	return cipherText
+}
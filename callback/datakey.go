@@ -0,0 +1,211 @@
+package callback
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlgDataKey 信封模式的算法标识：AES-256-GCM，数据密钥由主密钥包装后与密文一起存储，
+// 信封中的密钥 ID 为主密钥 ID，载荷为 <包装后的数据密钥>.<密文>
+const AlgDataKey = "dek"
+
+// 信封模式数据密钥的作用范围，通过 encryption:"mode:envelope;scope:table" 指定
+const (
+	// ScopeRow 每条记录生成一个数据密钥（默认），同一行的多个加密字段共用
+	ScopeRow = "row"
+	// ScopeTable 每张表在 DataKeyTTL 内共用一个数据密钥，写入时少调用一次 KMS，但一个数据密钥泄露影响的数据更多
+	ScopeTable = "table"
+)
+
+// DataKeyTTL 解包后的数据密钥在内存中缓存的时间，也是 ScopeTable 下一个数据密钥的使用时长
+var DataKeyTTL = 5 * time.Minute
+
+// dataKey 数据密钥，Plain 为明文密钥，Wrapped 为主密钥 KeyID 包装后的密钥
+type dataKey struct {
+	KeyID   string
+	Plain   []byte
+	Wrapped []byte
+}
+
+// rowKeys 加密一条记录时共享的状态，信封模式下同一行的字段共用一个数据密钥
+type rowKeys struct {
+	table    string
+	rowKey   *dataKey
+	tableKey *dataKey
+	// subject 当前加密的 mode:subject 字段所属的主体 ID，加密前由调用方设置
+	subject string
+}
+
+func newRowKeys(table string) *rowKeys {
+	return &rowKeys{table: table}
+}
+
+// dataKeyCache 带过期时间的数据密钥缓存
+type dataKeyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedDataKey
+}
+
+type cachedDataKey struct {
+	key     *dataKey
+	expires time.Time
+}
+
+func newDataKeyCache() *dataKeyCache {
+	return &dataKeyCache{entries: map[string]cachedDataKey{}}
+}
+
+func (c *dataKeyCache) get(id string) (*dataKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	return entry.key, true
+}
+
+func (c *dataKeyCache) put(id string, key *dataKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[id] = cachedDataKey{key: key, expires: now.Add(DataKeyTTL)}
+}
+
+func (c *dataKeyCache) delete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+func unwrappedKeyID(keyID string, wrapped []byte) string {
+	return keyID + envelopeSep + base64.StdEncoding.EncodeToString(wrapped)
+}
+
+// generateDataKey 生成随机数据密钥并用当前主密钥包装
+func (e *Encryptor) generateDataKey(ctx context.Context) (*dataKey, error) {
+	provider := e.keyProvider()
+	keyID, err := provider.CurrentKeyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, plain); err != nil {
+		return nil, err
+	}
+	wrapped, err := provider.WrapKey(ctx, keyID, plain)
+	if err != nil {
+		return nil, err
+	}
+	key := &dataKey{KeyID: keyID, Plain: plain, Wrapped: wrapped}
+	e.unwrappedKeys.put(unwrappedKeyID(keyID, wrapped), key)
+	return key, nil
+}
+
+// rowDataKey 返回当前记录在指定作用范围下使用的数据密钥
+func (e *Encryptor) rowDataKey(ctx context.Context, r *rowKeys, scope string) (key *dataKey, err error) {
+	if scope != ScopeTable {
+		if r.rowKey == nil {
+			r.rowKey, err = e.generateDataKey(ctx)
+		}
+		return r.rowKey, err
+	}
+	if r.tableKey != nil {
+		return r.tableKey, nil
+	}
+
+	keyID, err := e.keyProvider().CurrentKeyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := r.table + envelopeSep + keyID
+	if key, ok := e.tableKeys.get(id); ok {
+		r.tableKey = key
+		return key, nil
+	}
+	if key, err = e.generateDataKey(ctx); err != nil {
+		return nil, err
+	}
+	e.tableKeys.put(id, key)
+	r.tableKey = key
+	return key, nil
+}
+
+// sealDataKey 使用数据密钥加密，返回信封载荷 <包装后的数据密钥>.<nonce+密文>
+func sealDataKey(key *dataKey, plainText string) (string, error) {
+	aead, err := dataKeyAEAD(key.Plain)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plainText), nil)
+	return base64.StdEncoding.EncodeToString(key.Wrapped) + "." + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openDataKey 解包数据密钥（优先使用缓存）后解密信封载荷
+func (e *Encryptor) openDataKey(ctx context.Context, keyID, payload string) (string, error) {
+	wrappedText, sealedText, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", errors.New("encryption: invalid data key payload")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedText)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(sealedText)
+	if err != nil {
+		return "", err
+	}
+
+	id := unwrappedKeyID(keyID, wrapped)
+	key, ok := e.unwrappedKeys.get(id)
+	if !ok {
+		plain, err := e.keyProvider().UnwrapKey(ctx, keyID, wrapped)
+		if err != nil {
+			return "", err
+		}
+		key = &dataKey{KeyID: keyID, Plain: plain, Wrapped: wrapped}
+		e.unwrappedKeys.put(id, key)
+	}
+
+	aead, err := dataKeyAEAD(key.Plain)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encryption: ciphertext too short")
+	}
+	plainText, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+func dataKeyAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,127 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type testSecret struct {
+	ID      uint   `gorm:"primaryKey"`
+	Phone   string `encryption:"mode:envelope"`
+	Address string `encryption:"mode:envelope"`
+	Note    string `encryption:"mode:envelope;scope:table"`
+}
+
+// countingKeyProvider 统计解包次数，用于验证数据密钥缓存
+type countingKeyProvider struct {
+	KeyProvider
+	unwraps int32
+}
+
+func (p *countingKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	atomic.AddInt32(&p.unwraps, 1)
+	return p.KeyProvider.UnwrapKey(ctx, keyID, wrapped)
+}
+
+func TestNewFileKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "master.json")
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, _ := provider.CurrentKeyID(ctx)
+	wrapped, err := provider.WrapKey(ctx, keyID, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载同一个文件可以解包之前包装的数据密钥
+	reloaded, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		keyID   string
+		wrapped []byte
+		wantErr bool
+	}{
+		{name: "ok", keyID: keyID, wrapped: wrapped},
+		{name: "unknownKey", keyID: "k0", wrapped: wrapped, wantErr: true},
+		{name: "tampered", keyID: keyID, wrapped: append([]byte{1}, wrapped[1:]...), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reloaded.UnwrapKey(ctx, tt.keyID, tt.wrapped)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnwrapKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, []byte("0123456789abcdef0123456789abcdef")) {
+				t.Errorf("UnwrapKey() got = %s", got)
+			}
+		})
+	}
+}
+
+func TestEncrypt_Envelope(t *testing.T) {
+	fileProvider, err := NewFileKeyProvider(filepath.Join(t.TempDir(), "master.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingKeyProvider{KeyProvider: fileProvider}
+	e, _ := New(Config{KeyProvider: provider, FailOnDecryptError: true})
+	db := newEncryptorDB(t, e, &testSecret{})
+	secrets := []testSecret{
+		{Phone: "18601774393", Address: "shanghai", Note: "a"},
+		{Phone: "18601774394", Address: "beijing", Note: "b"},
+	}
+	if err := db.Create(&secrets).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raws []testSecretRaw
+	db.Raw("SELECT * FROM test_secrets ORDER BY id").Scan(&raws)
+	wrappedKey := func(value string) string {
+		e, ok := parseEnvelope(value)
+		if !ok || e.Algorithm != AlgDataKey || e.KeyID != "k1" {
+			t.Fatalf("value is not a data key envelope: %v", value)
+		}
+		wrapped, _, _ := strings.Cut(e.Payload, ".")
+		return wrapped
+	}
+	if wrappedKey(raws[0].Phone) != wrappedKey(raws[0].Address) {
+		t.Errorf("fields of the same row should share one data key")
+	}
+	if wrappedKey(raws[0].Phone) == wrappedKey(raws[1].Phone) {
+		t.Errorf("rows should use different data keys")
+	}
+	if wrappedKey(raws[0].Note) != wrappedKey(raws[1].Note) {
+		t.Errorf("scope:table fields should share one data key")
+	}
+
+	// 清空缓存后读取：每个数据密钥只解包一次
+	e.unwrappedKeys = newDataKeyCache()
+	for i := 0; i < 2; i++ {
+		var got []testSecret
+		if err := db.Order("id").Find(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got[0].Phone != "18601774393" || got[1].Address != "beijing" || got[1].Note != "b" {
+			t.Errorf("Find() got = %+v", got)
+		}
+	}
+	if unwraps := atomic.LoadInt32(&provider.unwraps); unwraps != 3 {
+		t.Errorf("UnwrapKey() called %d times, want 3", unwraps)
+	}
+}
+
+type testSecretRaw struct {
+	Phone   string
+	Address string
+	Note    string
+}
@@ -1,49 +1,171 @@
 package callback
 
 import (
-	"gorm.io/gorm"
+	"database/sql"
+	"errors"
 	"reflect"
-)
 
-func Register(db *gorm.DB) {
-	db.Callback().Query().After("gorm:after_query").Register("customer:decrypt_query", Decrypt)
-	db.Callback().Create().Before("gorm:before_create").Register("customer:encrypt_create", Encrypt)
-	db.Callback().Update().Before("gorm:before_update").Register("customer:encrypt_update", Encrypt)
-}
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
 
 var DATA_KEY = []byte("0123456789123456")
 
-// Decrypt 针对查询操作对数据进行解密操作 解密结构体中添加了 encryption:"true" tag的字段
-func Decrypt(db *gorm.DB) {
-	if db.Error == nil && db.Statement.Schema != nil && !db.Statement.SkipHooks {
-		callMethod(db, func(value interface{}, tx *gorm.DB) (called bool) {
-			reflectValue := reflect.ValueOf(value)
-			typeofRe := reflect.TypeOf(value)
-			if typeofRe.Kind() != reflect.Ptr {
-				called = false
-				return called
+// AllowMapScanKey 通过 db.Set(AllowMapScanKey, true) 允许将加密列扫描到 map 中，此时 map 中的加密列会被解密
+const AllowMapScanKey = "encryption:allow_map_scan"
+
+// ErrMapScan 未显式允许时将加密列扫描到 map 中返回的错误
+var ErrMapScan = errors.New("encryption: scanning encrypted columns into map is not allowed, use db.Set(callback.AllowMapScanKey, true) to allow")
+
+// Decrypt 针对查询操作对数据进行解密操作。
+// 扫描到结构体的加密字段已经在扫描阶段解密（见 prepareSchema），这里处理 Pluck 单列查询和 map 类型的查询结果
+func (e *Encryptor) Decrypt(db *gorm.DB) {
+	if db.Error != nil || db.Statement.SkipHooks || !db.Statement.ReflectValue.IsValid() {
+		return
+	}
+	sch := e.lookupSchema(db)
+	if sch == nil {
+		return
+	}
+
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Map:
+		e.decryptMap(db, sch, rv)
+	case reflect.Slice, reflect.Array:
+		elemType := rv.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		switch {
+		case elemType == nullStringType:
+			if ef, ok := e.pluckField(db, sch); ok {
+				for i := 0; i < rv.Len(); i++ {
+					e.decryptPlucked(db, ef, rv.Index(i))
+				}
 			}
-			reflectValue = reflectValue.Elem()
-			typeofRe = typeofRe.Elem()
-
-			// Iterate over the fields
-			for i := 0; i < typeofRe.NumField(); i++ {
-				field := typeofRe.Field(i)
-
-				// Get the "encryption" tag
-				encryptionTag := field.Tag.Get("encryption")
-
-				// Check if the encryption tag is set to "true"
-				if encryptionTag == "true" {
-					ecryptStr := reflectValue.Field(i).String()
-					decrypt, err := AesDecrypt(ecryptStr, DATA_KEY)
-					if err != nil {
-						db.AddError(err)
-					}
-					reflectValue.Field(i).SetString(decrypt)
+		case elemType.Kind() == reflect.Struct:
+		case elemType.Kind() == reflect.Map:
+			for i := 0; i < rv.Len(); i++ {
+				e.decryptMap(db, sch, reflect.Indirect(rv.Index(i)))
+			}
+		default:
+			if ef, ok := e.pluckField(db, sch); ok {
+				for i := 0; i < rv.Len(); i++ {
+					e.decryptPlucked(db, ef, rv.Index(i))
 				}
 			}
-			return called
-		})
+		}
+	}
+}
+
+// pluckField 返回 Pluck 查询的加密字段，查询的不是单个加密列（或是哈希列）时返回 false
+func (e *Encryptor) pluckField(db *gorm.DB, sch *schema.Schema) (encryptedField, bool) {
+	var column string
+	if len(db.Statement.Selects) == 1 {
+		column = db.Statement.Selects[0]
+	} else if c, ok := db.Statement.Clauses["SELECT"]; ok {
+		if sel, ok := c.Expression.(clause.Select); ok && len(sel.Columns) == 1 && !sel.Columns[0].Raw {
+			column = sel.Columns[0].Name
+		}
+	}
+	if column == "" {
+		return encryptedField{}, false
+	}
+	ef, ok := e.encryptedFieldOf(sch, column)
+	return ef, ok && ef.Options.Mode != ModeHash
+}
+
+// decryptPlucked 解密 Pluck 结果中的单个元素，支持 string、*string、[]byte 和 sql.NullString
+func (e *Encryptor) decryptPlucked(db *gorm.DB, ef encryptedField, elem reflect.Value) {
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return
+		}
+		elem = elem.Elem()
+	}
+
+	cipherText, ok := plainTextOf(elem.Interface())
+	if !ok {
+		return
+	}
+	plainText, err := e.decryptValue(db.Statement.Context, ef.Options, cipherText)
+	if err != nil {
+		switch decryptErr := e.decryptFailed(db.Statement.Context, ef, err); decryptErr.Policy {
+		case OnErrorNull:
+			elem.Set(reflect.Zero(elem.Type()))
+		case OnErrorStrict:
+			db.AddError(decryptErr)
+		}
+		return
+	}
+	e.recordAccess(db.Statement.Context, ef.Field, reflect.Value{}, "")
+	switch {
+	case elem.Type() == nullStringType:
+		elem.Set(reflect.ValueOf(sql.NullString{String: plainText, Valid: true}))
+	case elem.Kind() == reflect.String:
+		elem.SetString(plainText)
+	default:
+		elem.SetBytes([]byte(plainText))
+	}
+}
+
+// decryptMap 处理扫描到 map 的查询结果：默认拒绝包含加密列的结果，显式允许后解密加密列，哈希列原样返回
+func (e *Encryptor) decryptMap(db *gorm.DB, sch *schema.Schema, mapValue reflect.Value) {
+	m, ok := mapValue.Interface().(map[string]interface{})
+	if !ok {
+		return
+	}
+	allowed, _ := db.Get(AllowMapScanKey)
+	for column, value := range m {
+		ef, ok := e.encryptedFieldOf(sch, column)
+		if !ok || value == nil || ef.Options.Mode == ModeHash {
+			continue
+		}
+		if allowed != true {
+			db.AddError(ErrMapScan)
+			return
+		}
+
+		var cipherText string
+		switch v := value.(type) {
+		case string:
+			cipherText = v
+		case []byte:
+			cipherText = string(v)
+		default:
+			continue
+		}
+		plainText, err := e.decryptValue(db.Statement.Context, ef.Options, cipherText)
+		if err != nil {
+			switch decryptErr := e.decryptFailed(db.Statement.Context, ef, err); decryptErr.Policy {
+			case OnErrorNull:
+				m[column] = nil
+			case OnErrorStrict:
+				db.AddError(decryptErr)
+			}
+			continue
+		}
+		m[column] = plainText
+		e.recordAccess(db.Statement.Context, ef.Field, reflect.Value{}, primaryKeyOfMap(sch, m))
+	}
+}
+
+// DecryptField 按模型字段的 encryption tag 解密密文，用于 Row()/Rows() 手动扫描出的加密列，哈希字段返回 ErrHashField，例如：
+//
+//	db.Model(&model.Student{}).Select("phone").Where("id = ?", id).Row().Scan(&phone)
+//	phone, err = callback.DecryptField(db, &model.Student{}, "Phone", phone)
+func (e *Encryptor) DecryptField(db *gorm.DB, model interface{}, name, cipherText string) (string, error) {
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return "", err
+	}
+	if sch.LookUpField(name) == nil {
+		return "", errors.New("encryption: unknown field " + name)
+	}
+	ef, ok := e.encryptedFieldOf(sch, name)
+	if !ok {
+		return cipherText, nil
 	}
+	return e.decryptValue(db.Statement.Context, ef.Options, cipherText)
 }
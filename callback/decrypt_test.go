@@ -0,0 +1,177 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func createTestAccounts(t *testing.T, names ...string) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, &testAccount{})
+	for _, name := range names {
+		if err := db.Create(&testAccount{Name: name, Phone: "186" + name, Email: name + "@163.com"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestDecrypt_RawScan(t *testing.T) {
+	db := createTestAccounts(t, "a", "b")
+
+	var accounts []testAccount
+	if err := db.Raw("SELECT * FROM test_accounts ORDER BY id").Scan(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Phone != "186a" || accounts[1].Email != "b@163.com" {
+		t.Errorf("Raw().Scan() got = %+v", accounts)
+	}
+
+	var account testAccount
+	if err := db.Table("test_accounts").Where("name = ?", "b").Scan(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+	if account.Phone != "186b" {
+		t.Errorf("Table().Scan() got = %+v", account)
+	}
+
+	rows, err := db.Model(&testAccount{}).Order("id").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row testAccount
+		if err := db.ScanRows(rows, &row); err != nil {
+			t.Fatal(err)
+		}
+		if row.Phone != "186"+row.Name {
+			t.Errorf("ScanRows() got = %+v", row)
+		}
+	}
+}
+
+func TestDecrypt_Pluck(t *testing.T) {
+	db := createTestAccounts(t, "a", "b")
+
+	tests := []struct {
+		name  string
+		pluck func(dest *[]string) error
+		want  []string
+	}{
+		{name: "model", pluck: func(dest *[]string) error {
+			return db.Model(&testAccount{}).Order("id").Pluck("phone", dest).Error
+		}, want: []string{"186a", "186b"}},
+		{name: "fieldName", pluck: func(dest *[]string) error {
+			return db.Model(&testAccount{}).Order("id").Pluck("Email", dest).Error
+		}, want: []string{"a@163.com", "b@163.com"}},
+		{name: "table", pluck: func(dest *[]string) error {
+			return db.Table("test_accounts").Order("id").Pluck("phone", dest).Error
+		}, want: []string{"186a", "186b"}},
+		{name: "plain", pluck: func(dest *[]string) error {
+			return db.Model(&testAccount{}).Order("id").Pluck("name", dest).Error
+		}, want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if err := tt.pluck(&got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("Pluck() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecrypt_Map(t *testing.T) {
+	db := createTestAccounts(t, "a")
+
+	var denied []map[string]interface{}
+	if err := db.Model(&testAccount{}).Find(&denied).Error; !errors.Is(err, ErrMapScan) {
+		t.Errorf("Find() into map error = %v, want %v", err, ErrMapScan)
+	}
+
+	var nonEncrypted []map[string]interface{}
+	if err := db.Model(&testAccount{}).Select("id", "name").Find(&nonEncrypted).Error; err != nil {
+		t.Errorf("Find() non encrypted columns into map error = %v", err)
+	}
+
+	allowed := map[string]interface{}{}
+	if err := db.Set(AllowMapScanKey, true).Table("test_accounts").Take(&allowed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if allowed["phone"] != "186a" || allowed["email"] != "a@163.com" {
+		t.Errorf("Take() into allowed map got = %v", allowed)
+	}
+}
+
+func TestDecryptField_Row(t *testing.T) {
+	db := createTestAccounts(t, "a")
+
+	var phone string
+	if err := db.Model(&testAccount{}).Select("phone").Where("name = ?", "a").Row().Scan(&phone); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecryptField(db, &testAccount{}, "Phone", phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "186a" {
+		t.Errorf("DecryptField() got = %v, want %v", got, "186a")
+	}
+}
+
+type testMixed struct {
+	ID      uint    `gorm:"primaryKey"`
+	Phone   string  `encryption:"true;on_error:lenient"`
+	Email   string  `encryption:"true;on_error:null"`
+	Address *string `encryption:"true;on_error:null"`
+	IDCard  string  `encryption:"true"`
+}
+
+// TestDecrypt_Policy 逐步开启加密时表中同时存在明文和密文
+func TestDecrypt_Policy(t *testing.T) {
+	var reported []string
+	e, _ := New(Config{FailOnDecryptError: true, OnDecryptError: func(ctx context.Context, err *DecryptError) {
+		reported = append(reported, err.Column+":"+err.Policy)
+	}})
+	db := newEncryptorDB(t, e, &testMixed{})
+	if err := db.Exec("INSERT INTO test_mixeds (id, phone, email, address) VALUES (1, '18601774393', 'a@163.com', 'shanghai')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&testMixed{ID: 1}).Update("id_card", "310101").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var got testMixed
+	if err := db.First(&got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Phone != "18601774393" || got.Email != "" || got.Address != nil || got.IDCard != "310101" {
+		t.Errorf("First() got = %+v", got)
+	}
+	var emails []string
+	if err := db.Model(&testMixed{}).Pluck("email", &emails).Error; err != nil || len(emails) != 1 || emails[0] != "" {
+		t.Errorf("Pluck() got = %v, %v", emails, err)
+	}
+	wantReported := []string{"phone:lenient", "email:null", "address:null", "email:null"}
+	if strings.Join(reported, ",") != strings.Join(wantReported, ",") {
+		t.Errorf("OnDecryptError got = %v, want %v", reported, wantReported)
+	}
+
+	// 未指定 on_error 的字段按 FailOnDecryptError 返回错误
+	db.Exec("UPDATE test_mixeds SET id_card = '310101' WHERE id = 1")
+	var decryptErr *DecryptError
+	if err := db.First(&got, 1).Error; !errors.As(err, &decryptErr) || decryptErr.Column != "id_card" || decryptErr.Policy != OnErrorStrict {
+		t.Errorf("First() error = %v, want strict DecryptError on id_card", err)
+	}
+	if failures := e.DecryptFailures()["test_mixeds"]; failures != 8 {
+		t.Errorf("DecryptFailures() got = %v, want 8", failures)
+	}
+}
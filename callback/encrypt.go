@@ -1,41 +1,224 @@
 package callback
 
 import (
-	"gorm.io/gorm"
 	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
-// Encrypt 对新增和更新操作，加密添加了encryption:"true" tag的字段
-func Encrypt(db *gorm.DB) {
-	if db.Error == nil && db.Statement.Schema != nil && !db.Statement.SkipHooks {
-		callMethod(db, func(value interface{}, tx *gorm.DB) (called bool) {
-			reflectValue := reflect.ValueOf(value)
-			typeofRe := reflect.TypeOf(value)
-			if typeofRe.Kind() != reflect.Ptr {
-				called = false
-				return called
+// restoreKey 语句中记录被加密字段原始值的 key，见 Restore
+const restoreKey = "encryption:restore"
+
+// restoreEntry 记录某条记录的加密字段写入的密文和加密前的值
+type restoreEntry struct {
+	Field      *schema.Field
+	Row        reflect.Value
+	CipherText string
+	Original   interface{}
+}
+
+// Encrypt 对新增和更新操作，加密添加了encryption tag的字段，加密模式见 ModeRandom、ModeDeterministic。
+// 加密字段在每个 schema 上只解析一次，支持嵌入结构体以及 string、*string、[]byte、sql.NullString 类型。
+// hash tag 字段写入哈希值（见 HashTag）。调用方传入的结构体在语句执行后由 Restore 还原为明文（哈希字段保留哈希值）；Updates/Update 传入的 map 或结构体会先复制再加密，不修改调用方的值
+func (e *Encryptor) Encrypt(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.SkipHooks {
+		return
+	}
+	fields := e.prepareSchema(db.Statement.Schema)
+	if len(fields) == 0 {
+		return
+	}
+
+	var entries []restoreEntry
+	if destDiffers(db.Statement) {
+		entries = e.encryptDest(db)
+	} else {
+		entries = e.encryptReflectValue(db, fields, db.Statement.ReflectValue)
+	}
+	if len(entries) > 0 {
+		db.InstanceSet(restoreKey, entries)
+	}
+}
+
+// destDiffers 判断 Dest 与 Model 是否为不同的对象，例如 Updates/Update 传入的 map 或结构体
+func destDiffers(stmt *gorm.Statement) bool {
+	switch stmt.Dest.(type) {
+	case nil:
+		return false
+	case map[string]interface{}, []map[string]interface{}:
+		return true
+	}
+	dest := reflect.ValueOf(stmt.Dest)
+	switch dest.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Ptr:
+		model := reflect.ValueOf(stmt.Model)
+		return dest.Elem().Kind() == reflect.Struct && (model.Kind() != reflect.Ptr || model.Pointer() != dest.Pointer())
+	}
+	return false
+}
+
+// encryptReflectValue 原地加密结构体或结构体切片，返回用于还原的记录
+func (e *Encryptor) encryptReflectValue(db *gorm.DB, fields []encryptedField, rv reflect.Value) (entries []restoreEntry) {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if elem := reflect.Indirect(rv.Index(i)); elem.CanAddr() {
+				entries = append(entries, e.encryptStruct(db, fields, elem)...)
+			} else {
+				db.AddError(gorm.ErrInvalidValue)
+				return
 			}
-			reflectValue = reflectValue.Elem()
-			typeofRe = typeofRe.Elem()
-
-			// Iterate over the fields
-			for i := 0; i < typeofRe.NumField(); i++ {
-				field := typeofRe.Field(i)
-
-				// Get the "encryption" tag
-				encryptionTag := field.Tag.Get("encryption")
-
-				// Check if the encryption tag is set to "true"
-				if encryptionTag == "true" {
-					ecryptStr := reflectValue.Field(i).String()
-					decrypt, err := AesEncrypt([]byte(ecryptStr), DATA_KEY)
-					if err != nil {
-						db.AddError(err)
-					}
-					reflectValue.Field(i).SetString(decrypt)
-				}
+		}
+	case reflect.Struct:
+		if rv.CanAddr() {
+			entries = e.encryptStruct(db, fields, rv)
+		} else {
+			db.AddError(gorm.ErrInvalidValue)
+		}
+	}
+	return
+}
+
+// encryptStruct 加密单条记录中的加密字段
+func (e *Encryptor) encryptStruct(db *gorm.DB, fields []encryptedField, rv reflect.Value) (entries []restoreEntry) {
+	ctx := db.Statement.Context
+	var keys *rowKeys
+	for _, ef := range fields {
+		value, _ := ef.Field.ValueOf(ctx, rv)
+		plainText, ok := plainTextOf(value)
+		if !ok {
+			continue
+		}
+		if keys == nil {
+			keys = newRowKeys(ef.Field.Schema.Table)
+		}
+		if ef.Options.Mode == ModeSubject {
+			subject, err := e.subjectOf(db, ef, rv)
+			if err != nil {
+				db.AddError(err)
+				continue
+			}
+			keys.subject = subject
+		}
+		cipherText, changed, err := e.sealValue(ctx, ef.Options, plainText, keys)
+		if err != nil {
+			db.AddError(err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := ef.Field.Set(ctx, rv, ef.toFieldValue(cipherText)); err != nil {
+			db.AddError(err)
+			continue
+		}
+		if ef.Options.Mode == ModeHash {
+			// 哈希字段写入后保留哈希值，不还原明文
+			continue
+		}
+		entries = append(entries, restoreEntry{Field: ef.Field, Row: rv, CipherText: cipherText, Original: value})
+	}
+	return
+}
+
+// encryptDest 处理 Dest 与 Model 不同的语句，例如 db.Model(&s).Updates(map...)、db.Model(&s).Updates(model.Student{...})、
+// db.Model(&model.Student{}).Create(map...)：将 Dest 复制一份后加密，调用方的 map/结构体保持明文。
+// GORM 执行后会把写入的值回填到 Model，因此返回的还原记录指向 Model
+func (e *Encryptor) encryptDest(db *gorm.DB) (entries []restoreEntry) {
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		var values map[string]interface{}
+		values, entries = e.encryptMap(db, db.Statement.Schema, dest)
+		db.Statement.Dest = values
+	case []map[string]interface{}:
+		values := make([]map[string]interface{}, len(dest))
+		for i, m := range dest {
+			values[i], _ = e.encryptMap(db, db.Statement.Schema, m)
+		}
+		db.Statement.Dest = values
+	default:
+		destValue := reflect.Indirect(reflect.ValueOf(dest))
+		if destValue.Kind() != reflect.Struct {
+			return nil
+		}
+		destSchema, err := parseSchema(db, dest)
+		if err != nil {
+			db.AddError(err)
+			return nil
+		}
+		destFields := e.prepareSchema(destSchema)
+		if len(destFields) == 0 {
+			return nil
+		}
+
+		copied := reflect.New(destValue.Type())
+		copied.Elem().Set(destValue)
+		for _, entry := range e.encryptStruct(db, destFields, copied.Elem()) {
+			if field := db.Statement.Schema.LookUpField(entry.Field.Name); field != nil && db.Statement.ReflectValue.CanAddr() {
+				ef := encryptedField{Field: field}
+				plainText, _ := plainTextOf(entry.Original)
+				entries = append(entries, restoreEntry{Field: field, Row: db.Statement.ReflectValue, CipherText: entry.CipherText, Original: ef.toFieldValue(plainText)})
 			}
-			return called
-		})
+		}
+		db.Statement.Dest = copied.Interface()
+	}
+	return
+}
+
+// encryptMap 返回加密后的 map 副本，键可以是列名或字段名
+func (e *Encryptor) encryptMap(db *gorm.DB, sch *schema.Schema, m map[string]interface{}) (map[string]interface{}, []restoreEntry) {
+	var entries []restoreEntry
+	keys := newRowKeys(sch.Table)
+	values := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		values[key] = value
+		ef, ok := e.encryptedFieldOf(sch, key)
+		if !ok {
+			continue
+		}
+		plainText, ok := plainTextOf(value)
+		if !ok {
+			continue
+		}
+		if ef.Options.Mode == ModeSubject {
+			subject, err := e.subjectOfMap(db, ef, m)
+			if err != nil {
+				db.AddError(err)
+				continue
+			}
+			keys.subject = subject
+		}
+		cipherText, changed, err := e.sealValue(db.Statement.Context, ef.Options, plainText, keys)
+		if err != nil {
+			db.AddError(err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		values[key] = cipherText
+		if rv := db.Statement.ReflectValue; rv.Kind() == reflect.Struct && rv.CanAddr() && ef.Options.Mode != ModeHash {
+			entries = append(entries, restoreEntry{Field: ef.Field, Row: rv, CipherText: cipherText, Original: ef.toFieldValue(plainText)})
+		}
+	}
+	return values, entries
+}
+
+// Restore 在新增和更新结束后（无论成功与否）将 Encrypt 写入结构体的密文还原为明文，
+// 只还原仍然是本次写入密文的字段，不覆盖 AfterCreate/AfterUpdate 等钩子中修改过的值
+func (e *Encryptor) Restore(db *gorm.DB) {
+	value, ok := db.InstanceGet(restoreKey)
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	for _, entry := range value.([]restoreEntry) {
+		current, _ := entry.Field.ValueOf(ctx, entry.Row)
+		if cipherText, ok := plainTextOf(current); ok && cipherText == entry.CipherText {
+			db.AddError(entry.Field.Set(ctx, entry.Row, entry.Original))
+		}
 	}
 }
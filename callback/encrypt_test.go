@@ -0,0 +1,290 @@
+package callback
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testAccount struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:128"`
+	Phone string `gorm:"size:128" encryption:"true"`
+	Email string `gorm:"size:128;uniqueIndex" encryption:"mode:deterministic"`
+}
+
+// newTestDB 创建使用默认配置注册了加解密回调的内存数据库
+func newTestDB(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	return newEncryptorDB(t, newEncryptor(defaultEncryptor.config), models...)
+}
+
+// newEncryptorDB 创建注册了指定 Encryptor 的内存数据库
+func newEncryptorDB(t testing.TB, e *Encryptor, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := e.Register(db, models...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestParseEncryptionTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		tag    string
+		want   fieldOptions
+		wantOk bool
+	}{
+		{name: "none", tag: `json:"phone"`, wantOk: false},
+		{name: "false", tag: `encryption:"false"`, wantOk: false},
+		{name: "true", tag: `encryption:"true"`, want: fieldOptions{Mode: ModeRandom}, wantOk: true},
+		{name: "deterministic", tag: `encryption:"mode:deterministic"`, want: fieldOptions{Mode: ModeDeterministic}, wantOk: true},
+		{name: "trueWithMode", tag: `encryption:"true;mode:Deterministic"`, want: fieldOptions{Mode: ModeDeterministic}, wantOk: true},
+		{name: "plainSize", tag: `encryption:"true;plain_size:11"`, want: fieldOptions{Mode: ModeRandom, PlainSize: 11}, wantOk: true},
+		{name: "onError", tag: `encryption:"true;on_error:Lenient"`, want: fieldOptions{Mode: ModeRandom, OnError: OnErrorLenient}, wantOk: true},
+		{name: "hash", tag: `hash:"Bcrypt" encryption:"true"`, want: fieldOptions{Mode: ModeHash, Hash: HashBcrypt}, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := defaultEncryptor.parseTag(reflect.StructTag(tt.tag))
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("parseTag() got = %v %v, want %v %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestEncrypt_Deterministic(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	if err := db.Create(&testAccount{Name: "a", Phone: "18601774393", Email: "a@163.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testAccount{Name: "b", Phone: "18601774393", Email: "b@163.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw().Scan() 到非结构体时不会解密，可以读到原始密文
+	var phones, emails []string
+	db.Raw("SELECT phone FROM test_accounts ORDER BY id").Scan(&phones)
+	db.Raw("SELECT email FROM test_accounts ORDER BY id").Scan(&emails)
+	if phones[0] == phones[1] {
+		t.Errorf("random mode should produce different ciphertexts, got %v", phones)
+	}
+	want, _ := EncryptDeterministic(db, "a@163.com")
+	if emails[0] != want {
+		t.Errorf("deterministic ciphertext got = %v, want %v", emails[0], want)
+	}
+
+	// 唯一索引作用在密文上
+	if err := db.Create(&testAccount{Name: "c", Email: "a@163.com"}).Error; err == nil {
+		t.Errorf("Create() duplicate deterministic value expected unique constraint error")
+	}
+
+	tests := []struct {
+		name  string
+		query func(tx *gorm.DB) *gorm.DB
+		want  string
+	}{
+		{name: "struct", query: func(tx *gorm.DB) *gorm.DB { return tx.Where(&testAccount{Email: "b@163.com"}) }, want: "b"},
+		{name: "map", query: func(tx *gorm.DB) *gorm.DB { return tx.Where(map[string]interface{}{"email": "a@163.com"}) }, want: "a"},
+		{name: "in", query: func(tx *gorm.DB) *gorm.DB {
+			return tx.Where(map[string]interface{}{"email": []string{"b@163.com"}})
+		}, want: "b"},
+		{name: "helper", query: func(tx *gorm.DB) *gorm.DB {
+			email, _ := EncryptDeterministic(db, "a@163.com")
+			return tx.Where("email = ?", email)
+		}, want: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testAccount
+			if err := tt.query(db).First(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want || got.Phone != "18601774393" {
+				t.Errorf("First() got = %+v, want name %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type TestContact struct {
+	Mobile string `gorm:"size:128" encryption:"true"`
+}
+
+type testProfile struct {
+	ID uint `gorm:"primaryKey"`
+	TestContact
+	Nickname *string        `gorm:"size:128" encryption:"true"`
+	Avatar   []byte         `encryption:"true"`
+	Address  sql.NullString `gorm:"size:128" encryption:"mode:deterministic"`
+	Detail   struct {
+		Note string `gorm:"size:128" encryption:"true"`
+	} `gorm:"embedded;embeddedPrefix:detail_"`
+}
+
+func TestEncrypt_FieldTypes(t *testing.T) {
+	db := newTestDB(t, &testProfile{})
+	nickname := "zhangshenglu"
+	tests := []struct {
+		name    string
+		profile testProfile
+	}{
+		{name: "allSet", profile: testProfile{
+			TestContact: TestContact{Mobile: "18601774393"},
+			Nickname:    &nickname,
+			Avatar:      []byte("avatar"),
+			Address:     sql.NullString{String: "shanghai", Valid: true},
+		}},
+		{name: "nulls", profile: testProfile{TestContact: TestContact{Mobile: "18601774394"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.profile
+			want.Detail.Note = "note-" + tt.name
+			profile := want
+			if err := db.Create(&profile).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// 没有 encryption tag 的结构体可以读到原始密文
+			var raw struct {
+				Mobile     string
+				Nickname   *string
+				Address    *string
+				DetailNote string
+			}
+			db.Raw("SELECT * FROM test_profiles WHERE id = ?", profile.ID).Scan(&raw)
+			if raw.Mobile == want.Mobile || raw.DetailNote == want.Detail.Note {
+				t.Errorf("columns are not encrypted: %+v", raw)
+			}
+			if (raw.Nickname == nil) != (want.Nickname == nil) || (raw.Address == nil) != !want.Address.Valid {
+				t.Errorf("NULL values should stay NULL: %+v", raw)
+			}
+
+			var got testProfile
+			if err := db.First(&got, profile.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Mobile != want.Mobile || got.Detail.Note != want.Detail.Note ||
+				string(got.Avatar) != string(want.Avatar) || got.Address != want.Address {
+				t.Errorf("First() got = %+v, want %+v", got, want)
+			}
+			if (got.Nickname == nil) != (want.Nickname == nil) || (got.Nickname != nil && *got.Nickname != *want.Nickname) {
+				t.Errorf("First() Nickname got = %v, want %v", got.Nickname, want.Nickname)
+			}
+		})
+	}
+	if nickname != "zhangshenglu" {
+		t.Errorf("Create() must not modify the string pointed by *string field, got %v", nickname)
+	}
+}
+
+func TestEncrypt_KeepsCallerPlaintext(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	existing := testAccount{Name: "existing", Phone: "18600000000", Email: "existing@163.com"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		run       func(account *testAccount) error
+		wantErr   bool
+		wantPhone string
+	}{
+		{name: "create", run: func(account *testAccount) error {
+			return db.Create(account).Error
+		}, wantPhone: "18601774393"},
+		{name: "createFailed", run: func(account *testAccount) error {
+			account.Email = existing.Email
+			return db.Create(account).Error
+		}, wantErr: true, wantPhone: "18601774393"},
+		{name: "save", run: func(account *testAccount) error {
+			db.Create(account)
+			account.Phone = "18601774394"
+			return db.Save(account).Error
+		}, wantPhone: "18601774394"},
+		{name: "updatesMap", run: func(account *testAccount) error {
+			db.Create(account)
+			values := map[string]interface{}{"phone": "18601774395"}
+			if err := db.Model(account).Updates(values).Error; err != nil {
+				return err
+			}
+			if values["phone"] != "18601774395" {
+				t.Errorf("Updates() modified caller's map: %v", values)
+			}
+			return nil
+		}, wantPhone: "18601774395"},
+		{name: "updateColumn", run: func(account *testAccount) error {
+			db.Create(account)
+			return db.Model(account).Update("Phone", "18601774396").Error
+		}, wantPhone: "18601774396"},
+		{name: "updatesStruct", run: func(account *testAccount) error {
+			db.Create(account)
+			values := testAccount{Phone: "18601774397"}
+			if err := db.Model(account).Updates(values).Error; err != nil {
+				return err
+			}
+			return nil
+		}, wantPhone: "18601774397"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := &testAccount{Name: tt.name, Phone: "18601774393", Email: fmt.Sprintf("%d@163.com", i)}
+			if err := tt.run(account); (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if account.Phone != tt.wantPhone {
+				t.Errorf("caller's Phone got = %v, want %v", account.Phone, tt.wantPhone)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var raw string
+			db.Raw("SELECT phone FROM test_accounts WHERE id = ?", account.ID).Scan(&raw)
+			if raw == tt.wantPhone || raw == "" {
+				t.Errorf("stored phone is not encrypted: %v", raw)
+			}
+			var got testAccount
+			if err := db.First(&got, account.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Phone != tt.wantPhone {
+				t.Errorf("First() Phone got = %v, want %v", got.Phone, tt.wantPhone)
+			}
+		})
+	}
+}
+
+func TestEncrypt_CreateInBatchesKeepsPlaintext(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	accounts := []testAccount{
+		{Name: "a", Phone: "18601774393", Email: "a@163.com"},
+		{Name: "b", Phone: "18601774394", Email: "b@163.com"},
+	}
+	if err := db.CreateInBatches(&accounts, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if accounts[0].Phone != "18601774393" || accounts[1].Email != "b@163.com" {
+		t.Errorf("CreateInBatches() modified caller's slice: %+v", accounts)
+	}
+}
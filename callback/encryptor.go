@@ -0,0 +1,173 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Config 加解密配置，零值表示使用 DefaultKeyProvider、ModeRandom 和 encryption tag，解密失败时保留原始值
+type Config struct {
+	// KeyProvider 主密钥提供者，为空时使用 DefaultKeyProvider。信封模式用它包装数据密钥，
+	// 随机、确定性模式通过 KeyResolver 使用当前主密钥加密、按信封中的密钥 ID 解密。
+	// 轮换后确定性模式的旧密文不能再与新密文做等值匹配，需要重新保存
+	KeyProvider KeyProvider
+	// Algorithm encryption:"true" 字段使用的加密模式（ModeRandom、ModeDeterministic、ModeEnvelope、ModeToken、ModeSubject），为空时为 ModeRandom
+	Algorithm string
+	// TagName 标记加密字段的 struct tag 名称，为空时为 EncryptionTag
+	TagName string
+	// FailOnDecryptError 未通过 on_error 指定策略的字段解密失败时查询是否返回错误，
+	// true 等同于 OnErrorStrict，false 等同于 OnErrorLenient
+	FailOnDecryptError bool
+	// OnDecryptError 字段按 OnErrorLenient、OnErrorNull 策略忽略解密失败时调用，用于记录日志或告警
+	OnDecryptError func(ctx context.Context, err *DecryptError)
+	// AuditSink 接收加密字段的读取记录，为空时不审计，见 FieldAccess、TableAuditSink
+	AuditSink AuditSink
+	// DecryptLegacy 读取时把没有信封前缀的值按旧版本的无前缀密文解密，用于 MigrateLegacy 迁移完成前读取旧数据。
+	// 关闭时这类值按解密失败处理（ErrNotEnvelope）。写入和 Backfill 不会猜测旧格式
+	DecryptLegacy bool
+	// SubjectKeys 保存 ModeSubject 每个主体的数据密钥，使用 mode:subject 字段时必须配置，见 NewSubjectKeyStore
+	SubjectKeys *SubjectKeyStore
+}
+
+// Encryptor 加解密回调及其状态（已解析的加密字段、数据密钥缓存）。
+// 每个 *gorm.DB 注册各自的 Encryptor，不同实例可以使用不同的主密钥和配置，互不共享状态
+type Encryptor struct {
+	config Config
+
+	// preparedSchemas 已经安装过解密钩子的 schema
+	preparedSchemas sync.Map
+	// schemasByTable 表名到 schema 的映射，用于 Table("xxx") 这类没有模型的查询查找加密字段
+	schemasByTable sync.Map
+	prepareMu      sync.Mutex
+
+	// unwrappedKeys 解包后的数据密钥，key 为 主密钥ID:包装后的数据密钥
+	unwrappedKeys *dataKeyCache
+	// tableKeys ScopeTable 下每张表当前使用的数据密钥，key 为 表名:主密钥ID
+	tableKeys *dataKeyCache
+
+	failures decryptFailures
+}
+
+// New 按配置创建 Encryptor，Algorithm 不是支持的加密模式时返回 ErrUnknownMode
+func New(config Config) (*Encryptor, error) {
+	switch config.Algorithm {
+	case "":
+		config.Algorithm = ModeRandom
+	case ModeRandom, ModeDeterministic, ModeEnvelope, ModeToken, ModeSubject:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMode, config.Algorithm)
+	}
+	if config.TagName == "" {
+		config.TagName = EncryptionTag
+	}
+	return newEncryptor(config), nil
+}
+
+func newEncryptor(config Config) *Encryptor {
+	return &Encryptor{config: config, unwrappedKeys: newDataKeyCache(), tableKeys: newDataKeyCache()}
+}
+
+// defaultEncryptor 包级函数 Register 使用的配置，与重构前的行为一致：可以读取旧格式密文，解密失败时返回错误。
+// 也是没有注册 Encryptor 的 db 上包级函数使用的实例
+var defaultEncryptor = newEncryptor(Config{Algorithm: ModeRandom, TagName: EncryptionTag, FailOnDecryptError: true, DecryptLegacy: true})
+
+// encryptorName Encryptor 在 gorm.Config.Plugins 中的名称，同一个 *gorm.DB 派生出的会话共用同一个 Config
+const encryptorName = "callback:encryptor"
+
+// encryptorOf 返回 db 上注册的 Encryptor，未注册时返回默认实例
+func encryptorOf(db *gorm.DB) *Encryptor {
+	if e, ok := db.Config.Plugins[encryptorName].(*Encryptor); ok {
+		return e
+	}
+	return defaultEncryptor
+}
+
+// Name implements gorm.Plugin
+func (e *Encryptor) Name() string {
+	return encryptorName
+}
+
+// Initialize implements gorm.Plugin，等同于 e.Register(db)
+func (e *Encryptor) Initialize(db *gorm.DB) error {
+	return e.Register(db)
+}
+
+// keyProvider 返回信封模式使用的主密钥提供者
+func (e *Encryptor) keyProvider() KeyProvider {
+	if e.config.KeyProvider != nil {
+		return e.config.KeyProvider
+	}
+	return DefaultKeyProvider
+}
+
+// Register 注册加解密回调，models 中的模型会预先安装解密钩子，
+// 需要通过 Raw().Scan() 扫描的加密模型应在此注册。使用默认配置，需要自定义配置时使用 New
+func Register(db *gorm.DB, models ...interface{}) error {
+	return newEncryptor(defaultEncryptor.config).Register(db, models...)
+}
+
+// Register 在 db 上注册该实例的加解密回调，见包级函数 Register
+func (e *Encryptor) Register(db *gorm.DB, models ...interface{}) error {
+	db.Config.Plugins[encryptorName] = e
+	db.Callback().Query().Before("gorm:query").Register("customer:prepare_query", e.PrepareSchema)
+	db.Callback().Row().Before("gorm:row").Register("customer:prepare_row", e.PrepareSchema)
+	db.Callback().Query().After("gorm:after_query").Register("customer:decrypt_query", e.Decrypt)
+	db.Callback().Query().Before("gorm:query").Register("customer:audit_query", e.beginAudit)
+	db.Callback().Query().After("customer:decrypt_query").Register("customer:audit_query_flush", e.flushAudit)
+	db.Callback().Create().Before("gorm:before_create").Register("customer:encrypt_create", e.Encrypt)
+	db.Callback().Update().Before("gorm:before_update").Register("customer:encrypt_update", e.Encrypt)
+	db.Callback().Create().After("gorm:after_create").Register("customer:restore_create", e.Restore)
+	db.Callback().Update().After("gorm:after_update").Register("customer:restore_update", e.Restore)
+	db.Callback().Query().Before("gorm:query").Register("customer:encrypt_query_conditions", e.EncryptConditions)
+	db.Callback().Update().Before("gorm:update").Register("customer:encrypt_update_conditions", e.EncryptConditions)
+	db.Callback().Delete().Before("gorm:delete").Register("customer:encrypt_delete_conditions", e.EncryptConditions)
+	return e.registerModels(db, models...)
+}
+
+// 以下包级回调使用 db 上注册的 Encryptor，便于单独注册某个回调
+
+// PrepareSchema 见 Encryptor.PrepareSchema
+func PrepareSchema(db *gorm.DB) { encryptorOf(db).PrepareSchema(db) }
+
+// Decrypt 见 Encryptor.Decrypt
+func Decrypt(db *gorm.DB) { encryptorOf(db).Decrypt(db) }
+
+// Encrypt 见 Encryptor.Encrypt
+func Encrypt(db *gorm.DB) { encryptorOf(db).Encrypt(db) }
+
+// Restore 见 Encryptor.Restore
+func Restore(db *gorm.DB) { encryptorOf(db).Restore(db) }
+
+// EncryptConditions 见 Encryptor.EncryptConditions
+func EncryptConditions(db *gorm.DB) { encryptorOf(db).EncryptConditions(db) }
+
+// DecryptField 见 Encryptor.DecryptField
+func DecryptField(db *gorm.DB, model interface{}, name, cipherText string) (string, error) {
+	return encryptorOf(db).DecryptField(db, model, name, cipherText)
+}
+
+// HasEncryptedFields 判断 schema 中是否有 db 上注册的 Encryptor 处理的加密或哈希字段，只解析 tag，不安装解密钩子。
+// 查询缓存等保存扫描结果的插件用它跳过这类模型：解密在扫描阶段完成，扫描结果中已经是明文
+func HasEncryptedFields(db *gorm.DB, sch *schema.Schema) bool {
+	e := encryptorOf(db)
+	for _, field := range sch.Fields {
+		if _, ok := e.parseTag(field.Tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TagNameOf 返回 db 上注册的 Encryptor 标记加密字段的 struct tag 名称，见 Config.TagName
+func TagNameOf(db *gorm.DB) string {
+	return encryptorOf(db).config.TagName
+}
+
+// DecryptFailures 返回 db 上注册的 Encryptor 每张表的解密失败次数
+func DecryptFailures(db *gorm.DB) map[string]int64 {
+	return encryptorOf(db).DecryptFailures()
+}
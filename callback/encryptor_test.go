@@ -0,0 +1,163 @@
+package callback
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type testCustomTag struct {
+	ID    uint   `gorm:"primaryKey"`
+	Phone string `secret:"true"`
+	Email string `secret:"mode:deterministic"`
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    Config
+		wantErr error
+	}{
+		{name: "defaults", config: Config{}, want: Config{Algorithm: ModeRandom, TagName: EncryptionTag}},
+		{name: "custom", config: Config{Algorithm: ModeEnvelope, TagName: "secret", FailOnDecryptError: true}, want: Config{Algorithm: ModeEnvelope, TagName: "secret", FailOnDecryptError: true}},
+		{name: "unknownAlgorithm", config: Config{Algorithm: "rot13"}, wantErr: ErrUnknownMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.config)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.config.Algorithm != tt.want.Algorithm || got.config.TagName != tt.want.TagName || got.config.FailOnDecryptError != tt.want.FailOnDecryptError) {
+				t.Errorf("New() config = %+v, want %+v", got.config, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptor_Options(t *testing.T) {
+	e, _ := New(Config{Algorithm: ModeEnvelope, TagName: "secret"})
+	db := newEncryptorDB(t, e, &testCustomTag{})
+	row := testCustomTag{Phone: "18601774393", Email: "a@163.com"}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw testSecretRaw
+	db.Raw("SELECT phone FROM test_custom_tags WHERE id = ?", row.ID).Scan(&raw)
+	if !strings.HasPrefix(raw.Phone, "enc:1:"+AlgDataKey+":") {
+		t.Errorf("secret:\"true\" should use Config.Algorithm, got %v", raw.Phone)
+	}
+	var got testCustomTag
+	if err := db.Where(&testCustomTag{Email: "a@163.com"}).First(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Phone != "18601774393" {
+		t.Errorf("First() Phone got = %v", got.Phone)
+	}
+}
+
+// TestEncryptor_Isolation 两个数据库使用不同的主密钥，互不能解密对方的数据
+func TestEncryptor_Isolation(t *testing.T) {
+	newDB := func(name string, fail bool) *Encryptor {
+		provider, err := NewFileKeyProvider(filepath.Join(t.TempDir(), name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, _ := New(Config{KeyProvider: provider, Algorithm: ModeEnvelope, FailOnDecryptError: fail})
+		return e
+	}
+	primary := newEncryptorDB(t, newDB("primary", true), &testAccount{})
+	secret := testAccount{Name: "a", Phone: "18601774393", Email: "a@163.com"}
+	if err := primary.Create(&secret).Error; err != nil {
+		t.Fatal(err)
+	}
+	var raw testSecretRaw
+	primary.Raw("SELECT phone FROM test_accounts WHERE id = ?", secret.ID).Scan(&raw)
+
+	tests := []struct {
+		name      string
+		fail      bool
+		wantErr   bool
+		wantPhone string
+	}{
+		{name: "strict", fail: true, wantErr: true},
+		{name: "lenient", fail: false, wantPhone: raw.Phone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := newEncryptorDB(t, newDB(tt.name, tt.fail), &testAccount{})
+			if err := other.Exec("INSERT INTO test_accounts (id, name, phone) VALUES (?, ?, ?)", 1, "a", raw.Phone).Error; err != nil {
+				t.Fatal(err)
+			}
+			var got testAccount
+			err := other.First(&got, 1).Error
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("First() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Phone != tt.wantPhone {
+				t.Errorf("First() Phone got = %v, want %v", got.Phone, tt.wantPhone)
+			}
+		})
+	}
+
+	// 主库仍然可以正常解密
+	var got testAccount
+	if err := primary.First(&got, secret.ID).Error; err != nil || got.Phone != "18601774393" {
+		t.Errorf("First() on primary got = %+v, %v", got, err)
+	}
+}
+
+type testKeyed struct {
+	ID    uint   `gorm:"primaryKey"`
+	Phone string `gorm:"size:11" encryption:"mode:token"`
+	Email string `gorm:"size:128" encryption:"mode:deterministic"`
+	Name  string `gorm:"size:128" encryption:"true"`
+}
+
+// TestEncryptor_InstanceKeys 随机、确定性和令牌模式使用各自 KeyProvider 的主密钥，即使密钥 ID 相同也不共用 DATA_KEY
+func TestEncryptor_InstanceKeys(t *testing.T) {
+	newDB := func(key string) *gorm.DB {
+		e, _ := New(Config{KeyProvider: NewLocalKeyProvider(DefaultKeyID, map[string][]byte{DefaultKeyID: []byte(key)}), FailOnDecryptError: true})
+		return newEncryptorDB(t, e, &testKeyed{})
+	}
+	first, second := newDB("aaaaaaaaaaaaaaaa"), newDB("bbbbbbbbbbbbbbbb")
+	plain := testKeyed{ID: 1, Phone: "18601774393", Email: "a@163.com", Name: "zhang"}
+	for _, db := range []*gorm.DB{first, second} {
+		row := plain
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var raws [2]testKeyed
+	for i, db := range []*gorm.DB{first, second} {
+		db.Raw("SELECT phone, email, name FROM test_keyeds WHERE id = 1").Row().Scan(&raws[i].Phone, &raws[i].Email, &raws[i].Name)
+	}
+	if raws[0].Phone == raws[1].Phone || raws[0].Email == raws[1].Email {
+		t.Errorf("ciphertexts of different keys should differ, got %+v and %+v", raws[0], raws[1])
+	}
+	for i, db := range []*gorm.DB{first, second} {
+		email, _ := EncryptDeterministic(db, "a@163.com")
+		if email != raws[i].Email {
+			t.Errorf("EncryptDeterministic() got = %v, want %v", email, raws[i].Email)
+		}
+		var got testKeyed
+		if err := db.Where("email = ?", email).First(&got).Error; err != nil || got != plain {
+			t.Errorf("First() got = %+v, %v", got, err)
+		}
+	}
+
+	// 另一个库的主密钥解不开
+	if err := second.Exec("UPDATE test_keyeds SET email = ?, name = ? WHERE id = 1", raws[0].Email, raws[0].Name).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got testKeyed
+	if err := second.First(&got, 1).Error; err == nil {
+		t.Errorf("First() with another key got = %+v, want error", got)
+	}
+}
@@ -0,0 +1,144 @@
+package callback
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 密文信封格式：enc:<版本>:<算法>:<密钥ID>:<base64 密文>，例如 enc:1:cbc:0:Y7At/Uvknz...
+// 前缀和算法让插件可以识别已经加密过的值，密钥 ID 用于密钥轮换后选择解密密钥
+const (
+	envelopePrefix  = "enc"
+	envelopeVersion = "1"
+	envelopeSep     = ":"
+)
+
+// 信封中的算法标识
+const (
+	// AlgAESCBC AES-CBC + 随机 IV，对应 ModeRandom
+	AlgAESCBC = "cbc"
+	// AlgAESSIV AES-SIV，对应 ModeDeterministic
+	AlgAESSIV = "siv"
+)
+
+// DefaultKeyID DATA_KEY 在 DefaultKeyProvider 中的密钥 ID，旧格式密文使用 KeyProvider 中该 ID 的主密钥解密
+const DefaultKeyID = "0"
+
+// ErrNotEnvelope 读取到没有信封前缀的值，且没有开启 Config.DecryptLegacy
+var ErrNotEnvelope = errors.New("encryption: value is not an envelope ciphertext")
+
+// Format 字段值的格式
+type Format int
+
+const (
+	// FormatPlain 明文
+	FormatPlain Format = iota
+	// FormatEnvelope 带信封前缀的密文
+	FormatEnvelope
+	// FormatLegacy 旧版本写入的无前缀 base64 密文，DetectFormat 不会返回，只有 MigrateLegacy 尝试解密识别
+	FormatLegacy
+	// FormatHash hash tag 字段中已经写入的哈希值
+	FormatHash
+)
+
+// envelope 解析后的密文信封
+type envelope struct {
+	Version   string
+	Algorithm string
+	KeyID     string
+	Payload   string
+}
+
+func (e envelope) String() string {
+	return strings.Join([]string{envelopePrefix, e.Version, e.Algorithm, e.KeyID, e.Payload}, envelopeSep)
+}
+
+// newEnvelope 使用当前版本创建信封
+func newEnvelope(algorithm, keyID, payload string) envelope {
+	return envelope{Version: envelopeVersion, Algorithm: algorithm, KeyID: keyID, Payload: payload}
+}
+
+// parseEnvelope 解析密文信封，不是合法信封时返回 false
+func parseEnvelope(s string) (envelope, bool) {
+	if !strings.HasPrefix(s, envelopePrefix+envelopeSep) {
+		return envelope{}, false
+	}
+	parts := strings.SplitN(s, envelopeSep, 5)
+	if len(parts) != 5 || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return envelope{}, false
+	}
+	e := envelope{Version: parts[1], Algorithm: parts[2], KeyID: parts[3], Payload: parts[4]}
+	if e.Version != envelopeVersion {
+		return envelope{}, false
+	}
+	return e, true
+}
+
+// DetectFormat 判断字段值是明文、信封密文还是哈希值，mode 为字段的加密模式。
+// 没有信封前缀的值一律视为明文，不尝试按旧格式解密：形如 base64 的明文可能恰好能被解密，猜测会把明文改写成乱码。
+// 旧格式密文只通过 MigrateLegacy 显式迁移
+func DetectFormat(value, mode string) Format {
+	if mode == ModeHash {
+		if hashAlgorithmOf(value) != "" {
+			return FormatHash
+		}
+		return FormatPlain
+	}
+	if _, ok := parseEnvelope(value); ok {
+		return FormatEnvelope
+	}
+	return FormatPlain
+}
+
+// IsEncrypted 判断值是否已经是信封密文
+func IsEncrypted(value string) bool {
+	_, ok := parseEnvelope(value)
+	return ok
+}
+
+// decryptLegacy 解密没有信封前缀的旧格式密文，旧版本使用 DATA_KEY 加密，对应 KeyProvider 中 DefaultKeyID 的主密钥
+func (e *Encryptor) decryptLegacy(ctx context.Context, mode, cipherText string) (string, error) {
+	cipherData, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", err
+	}
+	key, err := e.keyByID(ctx, DefaultKeyID)
+	if err != nil {
+		return "", err
+	}
+	switch mode {
+	case ModeDeterministic:
+		if len(cipherData) < aes.BlockSize {
+			return "", fmt.Errorf("legacy ciphertext too short")
+		}
+		return AesSivDecrypt(cipherText, key)
+	default:
+		if len(cipherData) < 2*aes.BlockSize || len(cipherData)%aes.BlockSize != 0 {
+			return "", fmt.Errorf("legacy ciphertext size %d is invalid", len(cipherData))
+		}
+		return AesDecrypt(cipherText, key)
+	}
+}
+
+// keyByID 通过 KeyProvider 返回信封中密钥 ID 对应的主密钥，KeyProvider 需要实现 KeyResolver
+func (e *Encryptor) keyByID(ctx context.Context, keyID string) ([]byte, error) {
+	resolver, ok := e.keyProvider().(KeyResolver)
+	if !ok {
+		return nil, ErrKeyNotExportable
+	}
+	return resolver.Key(ctx, keyID)
+}
+
+// currentKey 返回 KeyProvider 当前的主密钥及其 ID，随机、确定性模式使用它加密
+func (e *Encryptor) currentKey(ctx context.Context) (string, []byte, error) {
+	keyID, err := e.keyProvider().CurrentKeyID(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := e.keyByID(ctx, keyID)
+	return keyID, key, err
+}
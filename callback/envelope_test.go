@@ -0,0 +1,193 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   envelope
+		wantOk bool
+	}{
+		{name: "cbc", value: "enc:1:cbc:0:Y7At/Uvknz==", want: envelope{Version: "1", Algorithm: "cbc", KeyID: "0", Payload: "Y7At/Uvknz=="}, wantOk: true},
+		{name: "plain", value: "18601774393", wantOk: false},
+		{name: "legacy", value: "Y7At/UvknzizhdHq2d1MwPSLBarA9HDnYUxoA4ZyBTg=", wantOk: false},
+		{name: "unknownVersion", value: "enc:2:cbc:0:Y7At", wantOk: false},
+		{name: "missingParts", value: "enc:1:cbc", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEnvelope(tt.value)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("parseEnvelope() got = %+v %v, want %+v %v", got, ok, tt.want, tt.wantOk)
+			}
+			if ok && got.String() != tt.value {
+				t.Errorf("String() got = %v, want %v", got.String(), tt.value)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	legacy, _ := AesEncrypt([]byte("18601774393"), DATA_KEY)
+	legacySiv, _ := AesSivEncrypt([]byte("a@163.com"), DATA_KEY)
+	current, _ := defaultEncryptor.encryptValue(context.Background(), fieldOptions{Mode: ModeRandom}, "18601774393", nil)
+	tests := []struct {
+		name  string
+		value string
+		mode  string
+		want  Format
+	}{
+		{name: "plain", value: "18601774393", mode: ModeRandom, want: FormatPlain},
+		{name: "base64Plain", value: "aGVsbG8=", mode: ModeRandom, want: FormatPlain},
+		// 不再猜测旧格式，只有 MigrateLegacy 显式识别
+		{name: "legacy", value: legacy, mode: ModeRandom, want: FormatPlain},
+		{name: "legacySiv", value: legacySiv, mode: ModeDeterministic, want: FormatPlain},
+		{name: "envelope", value: current, mode: ModeRandom, want: FormatEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.value, tt.mode); got != tt.want {
+				t.Errorf("DetectFormat() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncrypt_SkipsAlreadyEncrypted(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	cipherText, _ := defaultEncryptor.encryptValue(context.Background(), fieldOptions{Mode: ModeRandom}, "18601774393", nil)
+	account := testAccount{Name: "a", Phone: cipherText, Email: "a@163.com"}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw string
+	db.Raw("SELECT phone FROM test_accounts WHERE id = ?", account.ID).Scan(&raw)
+	if raw != cipherText {
+		t.Errorf("already encrypted value was encrypted again: %v", raw)
+	}
+	var got testAccount
+	db.First(&got, account.ID)
+	if got.Phone != "18601774393" {
+		t.Errorf("First() Phone got = %v", got.Phone)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	db := newTestDB(t, &testAccount{})
+	for i, phone := range []string{"18601774393", "18601774394", "18601774395"} {
+		legacy, _ := AesEncrypt([]byte(phone), DATA_KEY)
+		email, _ := AesSivEncrypt([]byte(phone+"@163.com"), DATA_KEY)
+		if err := db.Exec("INSERT INTO test_accounts (id, name, phone, email) VALUES (?, ?, ?, ?)", i+1, phone, legacy, email).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 旧格式的密文可以直接读取
+	var accounts []testAccount
+	if err := db.Order("id").Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if account.Phone != account.Name || account.Email != account.Name+"@163.com" {
+			t.Errorf("Find() legacy row got = %+v", account)
+		}
+	}
+
+	// 重新保存时迁移为信封格式
+	accounts[0].Name = "saved"
+	if err := db.Save(&accounts[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := MigrateLegacy(db, &testAccount{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 2 {
+		t.Errorf("MigrateLegacy() migrated = %v, want 2", migrated)
+	}
+	if migrated, _ := MigrateLegacy(db, &testAccount{}, 1); migrated != 0 {
+		t.Errorf("MigrateLegacy() second run migrated = %v, want 0", migrated)
+	}
+
+	var raws []string
+	db.Raw("SELECT phone FROM test_accounts UNION ALL SELECT email FROM test_accounts").Scan(&raws)
+	for _, raw := range raws {
+		if !strings.HasPrefix(raw, "enc:1:") {
+			t.Errorf("value is not migrated: %v", raw)
+		}
+	}
+}
+
+// TestBackfill_LegacyLookingPlaintext 恰好能按旧格式解密的明文在 Backfill 中按原值加密，不会被改写
+func TestBackfill_LegacyLookingPlaintext(t *testing.T) {
+	e, _ := New(Config{FailOnDecryptError: true})
+	db := newEncryptorDB(t, e, &testAccount{})
+	value, _ := AesEncrypt([]byte("18601774393"), DATA_KEY)
+	if err := db.Exec("INSERT INTO test_accounts (id, name, phone, email) VALUES (?, ?, ?, ?)", 1, "a", value, "a@163.com").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Backfill(db, &testAccount{}, BackfillOptions{Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	var got testAccount
+	if err := db.First(&got, 1).Error; err != nil || got.Phone != value {
+		t.Errorf("First() got = %+v, %v, want phone %v", got, err, value)
+	}
+}
+
+func TestDecrypt_LegacyOptIn(t *testing.T) {
+	legacy, _ := AesEncrypt([]byte("18601774393"), DATA_KEY)
+	tests := []struct {
+		name    string
+		config  Config
+		want    string
+		wantErr error
+	}{
+		{name: "disabled", config: Config{}, wantErr: ErrNotEnvelope},
+		{name: "enabled", config: Config{DecryptLegacy: true}, want: "18601774393"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newEncryptor(tt.config).decryptValue(context.Background(), fieldOptions{Mode: ModeRandom}, legacy)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("decryptValue() got = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestKeyRotation 信封中的密钥 ID 通过 KeyProvider 解析，轮换后旧密钥写入的密文仍然可以解密
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := DATA_KEY, []byte("abcdefghijklmnop")
+	ctx := context.Background()
+	before := newEncryptor(Config{KeyProvider: NewLocalKeyProvider("0", map[string][]byte{"0": oldKey})})
+	after := newEncryptor(Config{KeyProvider: NewLocalKeyProvider("k2", map[string][]byte{"0": oldKey, "k2": newKey})})
+	removed := newEncryptor(Config{KeyProvider: NewLocalKeyProvider("k2", map[string][]byte{"k2": newKey})})
+
+	for _, mode := range []string{ModeRandom, ModeDeterministic} {
+		t.Run(mode, func(t *testing.T) {
+			opts := fieldOptions{Mode: mode}
+			old, _ := before.encryptValue(ctx, opts, "18601774393", nil)
+			current, _ := after.encryptValue(ctx, opts, "18601774393", nil)
+			if env, _ := parseEnvelope(current); env.KeyID != "k2" {
+				t.Errorf("encryptValue() key id got = %v, want k2", env.KeyID)
+			}
+			for _, cipherText := range []string{old, current} {
+				if got, err := after.decryptValue(ctx, opts, cipherText); err != nil || got != "18601774393" {
+					t.Errorf("decryptValue(%v) got = %v, %v", cipherText, got, err)
+				}
+			}
+			if _, err := removed.decryptValue(ctx, opts, old); err == nil {
+				t.Errorf("decryptValue() with removed key id should fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package callback
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// NIST SP 800-38G FF1 示例向量（radix 10）
+func TestFF1(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		tweak string
+		plain string
+		want  string
+	}{
+		{name: "aes128", key: "2B7E151628AED2A6ABF7158809CF4F3C", plain: "0123456789", want: "2433477484"},
+		{name: "aes128Tweak", key: "2B7E151628AED2A6ABF7158809CF4F3C", tweak: "39383736353433323130", plain: "0123456789", want: "6124200773"},
+		{name: "aes256", key: "2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", plain: "0123456789", want: "6657667009"},
+		{name: "aes256Tweak", key: "2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", tweak: "39383736353433323130", plain: "0123456789", want: "1001623463"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, _ := hex.DecodeString(tt.key)
+			tweak, _ := hex.DecodeString(tt.tweak)
+			got, err := FF1Encrypt(key, tweak, tt.plain)
+			if err != nil || got != tt.want {
+				t.Fatalf("FF1Encrypt() got = %v, %v, want %v", got, err, tt.want)
+			}
+			if plain, err := FF1Decrypt(key, tweak, got); err != nil || plain != tt.plain {
+				t.Errorf("FF1Decrypt() got = %v, %v, want %v", plain, err, tt.plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package callback
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashTag 标记只需要哈希、不需要解密的字段（例如密码）的 struct tag 名称，例如 hash:"argon2id"。
+// 哈希字段在新增和更新时写入哈希值，已经是哈希值的不再重复哈希；查询时原样返回哈希值，不会解密，
+// 调用方传入的结构体在写入后保留哈希值。校验明文使用 Verify
+const HashTag = "hash"
+
+// ModeHash 哈希字段在 fieldOptions 中的模式，具体算法见 fieldOptions.Hash
+const ModeHash = "hash"
+
+// hash tag 支持的算法
+const (
+	// HashArgon2id Argon2id（RFC 9106），参数见 Argon2Params，哈希值为 PHC 格式：$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+	HashArgon2id = "argon2id"
+	// HashBcrypt bcrypt，成本为 BcryptCost，明文最长 72 字节
+	HashBcrypt = "bcrypt"
+)
+
+// Argon2idParams Argon2id 的参数
+type Argon2idParams struct {
+	// Memory 内存大小，单位 KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+var (
+	// Argon2Params 新写入的 Argon2id 哈希使用的参数，默认为 RFC 9106 推荐的 64 MiB 内存、3 次迭代。
+	// 参数记录在哈希值中，修改后已有的哈希仍然可以校验。内存不能超过 256 MiB、迭代次数不能超过 16，盐 8~64 字节，哈希 16~128 字节
+	Argon2Params = Argon2idParams{Memory: 64 * 1024, Time: 3, Threads: 4, SaltLen: 16, KeyLen: 32}
+	// BcryptCost 新写入的 bcrypt 哈希使用的成本
+	BcryptCost = bcrypt.DefaultCost
+)
+
+var (
+	// ErrMalformedHash 哈希值格式不正确
+	ErrMalformedHash = errors.New("encryption: malformed hash")
+	// ErrHashField 尝试解密 hash tag 字段，哈希值只能通过 Verify 校验
+	ErrHashField = errors.New("encryption: hashed field can not be decrypted, use Verify")
+)
+
+// argon2idPrefix Argon2id 哈希值的前缀
+const argon2idPrefix = "$argon2id$"
+
+// 哈希值中 Argon2id 参数的范围，超出范围的哈希值视为格式不正确，避免伪造的参数在校验时 panic 或占用大量内存、CPU。
+// Argon2Params 也需要在这个范围内
+const (
+	argon2MaxMemory  = 256 * 1024 // 256 MiB，单位 KiB
+	argon2MaxTime    = 16
+	argon2MinSaltLen = 8
+	argon2MaxSaltLen = 64
+	argon2MinKeyLen  = 16
+	argon2MaxKeyLen  = 128
+)
+
+// bcryptAlphabet bcrypt 哈希值中盐和哈希使用的 base64 字符
+const bcryptAlphabet = "./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// argon2idHash 解析后的 Argon2id 哈希值
+type argon2idHash struct {
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+// parseArgon2id 按 PHC 格式解析 Argon2id 哈希值，版本、参数、盐和哈希都合法时才返回 true
+func parseArgon2id(value string) (argon2idHash, bool) {
+	var (
+		h                              argon2idHash
+		version, memory, time, threads int
+	)
+	parts := strings.Split(value, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HashArgon2id {
+		return h, false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version ||
+		parts[2] != fmt.Sprintf("v=%d", version) {
+		return h, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil ||
+		parts[3] != fmt.Sprintf("m=%d,t=%d,p=%d", memory, time, threads) {
+		return h, false
+	}
+	if memory <= 0 || memory > argon2MaxMemory || time <= 0 || time > argon2MaxTime || threads <= 0 || threads > 255 {
+		return h, false
+	}
+	encoding := base64.RawStdEncoding.Strict()
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil || len(salt) < argon2MinSaltLen || len(salt) > argon2MaxSaltLen {
+		return h, false
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) < argon2MinKeyLen || len(key) > argon2MaxKeyLen {
+		return h, false
+	}
+	return argon2idHash{memory: uint32(memory), time: uint32(time), threads: uint8(threads), salt: salt, key: key}, true
+}
+
+// isBcrypt 判断是否为 bcrypt 哈希值：版本、成本合法，盐和哈希只包含 bcrypt 的 base64 字符
+func isBcrypt(value string) bool {
+	if len(value) != 60 || !(strings.HasPrefix(value, "$2a$") || strings.HasPrefix(value, "$2b$") || strings.HasPrefix(value, "$2y$")) {
+		return false
+	}
+	if _, err := bcrypt.Cost([]byte(value)); err != nil || value[6] != '$' {
+		return false
+	}
+	for _, c := range value[7:] {
+		if !strings.ContainsRune(bcryptAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashAlgorithmOf 识别哈希值的算法，不是完整合法的哈希值时返回空字符串。
+// 只检查前缀会把以 $argon2id$ 等开头的明文当作哈希值原样保存
+func hashAlgorithmOf(value string) string {
+	if _, ok := parseArgon2id(value); ok {
+		return HashArgon2id
+	}
+	if isBcrypt(value) {
+		return HashBcrypt
+	}
+	return ""
+}
+
+// hashValue 使用 algorithm 计算明文的哈希值
+func hashValue(algorithm, plainText string) (string, error) {
+	switch algorithm {
+	case HashArgon2id:
+		p := Argon2Params
+		if p.Memory == 0 || p.Memory > argon2MaxMemory || p.Time == 0 || p.Time > argon2MaxTime || p.Threads == 0 ||
+			p.SaltLen < argon2MinSaltLen || p.SaltLen > argon2MaxSaltLen || p.KeyLen < argon2MinKeyLen || p.KeyLen > argon2MaxKeyLen {
+			return "", fmt.Errorf("encryption: Argon2Params %+v out of range", p)
+		}
+		salt := make([]byte, p.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(plainText), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(plainText), BcryptCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("encryption: unknown hash algorithm %q", algorithm)
+	}
+}
+
+// hashSize 哈希值的最大长度，用于检查列长度
+func hashSize(algorithm string) int {
+	if algorithm == HashBcrypt {
+		return 60
+	}
+	p := Argon2Params
+	base64Size := func(n int) int { return (n*8 + 5) / 6 }
+	params := fmt.Sprintf("v=%d$m=%d,t=%d,p=%d$", argon2.Version, p.Memory, p.Time, p.Threads)
+	return len(argon2idPrefix) + len(params) + base64Size(p.SaltLen) + 1 + base64Size(int(p.KeyLen))
+}
+
+// verifyHash 校验明文与哈希值是否匹配，算法和参数从哈希值中读取，参数超出范围时返回 ErrMalformedHash
+func verifyHash(hash, plainText string) (bool, error) {
+	if h, ok := parseArgon2id(hash); ok {
+		got := argon2.IDKey([]byte(plainText), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(got, h.key) == 1, nil
+	}
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plainText))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, ErrMalformedHash
+}
+
+// Verify 校验模型中 hash tag 字段保存的哈希值与明文是否匹配，model 为从数据库查询出的结构体（或其指针），field 为字段名，例如：
+//
+//	db.Where("name = ?", name).First(&user)
+//	ok, err := callback.Verify(&user, "Password", password)
+func Verify(model interface{}, field, plainText string) (bool, error) {
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	if rv.Kind() != reflect.Struct {
+		return false, fmt.Errorf("encryption: Verify expects a struct, got %T", model)
+	}
+	sf, ok := rv.Type().FieldByName(field)
+	if !ok {
+		return false, errors.New("encryption: unknown field " + field)
+	}
+	if _, ok := sf.Tag.Lookup(HashTag); !ok {
+		return false, fmt.Errorf("encryption: field %s has no %s tag", field, HashTag)
+	}
+	hash, ok := plainTextOf(rv.FieldByIndex(sf.Index).Interface())
+	if !ok || hash == "" {
+		return false, nil
+	}
+	return verifyHash(hash, plainText)
+}
@@ -0,0 +1,177 @@
+package callback
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testLogin struct {
+	ID       uint   `gorm:"primaryKey"`
+	Name     string `gorm:"size:32"`
+	Password string `gorm:"size:128" hash:"argon2id"`
+	Pin      string `gorm:"size:60" hash:"bcrypt"`
+}
+
+func TestEncrypt_Hash(t *testing.T) {
+	cost := BcryptCost
+	BcryptCost = bcrypt.MinCost
+	t.Cleanup(func() { BcryptCost = cost })
+
+	db := newTestDB(t, &testLogin{})
+	login := testLogin{Name: "zhang", Password: "secret", Pin: "123456"}
+	if err := db.Create(&login).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(login.Password, argon2idPrefix) || !strings.HasPrefix(login.Pin, "$2a$") {
+		t.Fatalf("Create() should keep the hashes in the struct, got %+v", login)
+	}
+	password := login.Password
+
+	var got testLogin
+	if err := db.First(&got, login.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != password {
+		t.Errorf("First() should return the stored hash, got %v", got.Password)
+	}
+	// 已经是哈希值的字段不会重复哈希
+	if err := db.Save(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&got).Updates(map[string]interface{}{"pin": "654321"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var updated testLogin
+	db.First(&updated, login.ID)
+	if updated.Password != password {
+		t.Errorf("Save() should not hash the hash again, got %v", updated.Password)
+	}
+
+	tests := []struct {
+		name      string
+		field     string
+		plainText string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "argon2id", field: "Password", plainText: "secret", want: true},
+		{name: "argon2id mismatch", field: "Password", plainText: "Secret"},
+		{name: "bcrypt updated", field: "Pin", plainText: "654321", want: true},
+		{name: "bcrypt old", field: "Pin", plainText: "123456"},
+		{name: "not hashed", field: "Name", plainText: "zhang", wantErr: true},
+		{name: "unknown", field: "Unknown", plainText: "zhang", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(&updated, tt.field, tt.plainText)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Verify() got = %v, err = %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	var pins []string
+	if err := db.Model(&testLogin{}).Pluck("pin", &pins).Error; err != nil || len(pins) != 1 || pins[0] != updated.Pin {
+		t.Errorf("Pluck() got = %v, err = %v", pins, err)
+	}
+	if _, err := DecryptField(db, &testLogin{}, "Password", password); !errors.Is(err, ErrHashField) {
+		t.Errorf("DecryptField() err = %v, want %v", err, ErrHashField)
+	}
+}
+
+func TestBackfill_Hash(t *testing.T) {
+	cost := BcryptCost
+	BcryptCost = bcrypt.MinCost
+	t.Cleanup(func() { BcryptCost = cost })
+
+	db := newTestDB(t, &testLogin{})
+	if err := db.Exec("INSERT INTO test_logins (id, name, password, pin) VALUES (1, 'zhang', 'secret', '123456')").Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := Backfill(db, &testLogin{}, BackfillOptions{Verify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(1 - i); got.Updated != want {
+			t.Errorf("Backfill() run %d updated = %v, want %v", i, got.Updated, want)
+		}
+	}
+	var login testLogin
+	db.First(&login, 1)
+	if ok, err := Verify(login, "Pin", "123456"); !ok || err != nil {
+		t.Errorf("Verify() after Backfill got = %v, err = %v", ok, err)
+	}
+}
+
+// argon2idTestHash 使用指定参数、16 字节的盐和 keyLen 字节的哈希拼接 Argon2id 哈希值
+func argon2idTestHash(params string, keyLen int) string {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("saltsaltsaltsalt"))
+	key := base64.RawStdEncoding.EncodeToString(bytes.Repeat([]byte("k"), keyLen))
+	return "$argon2id$v=19$" + params + "$" + salt + "$" + key
+}
+
+func TestVerifyHash_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "plain", hash: "secret"},
+		{name: "argon2id parts", hash: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA"},
+		{name: "argon2id version", hash: "$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$aGFzaA"},
+		{name: "argon2id salt", hash: "$argon2id$v=19$m=65536,t=3,p=4$!!$aGFzaA"},
+		{name: "argon2id short salt", hash: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$" + base64.RawStdEncoding.EncodeToString(make([]byte, 32))},
+		{name: "argon2id t=0", hash: argon2idTestHash("m=65536,t=0,p=4", 32)},
+		{name: "argon2id p=0", hash: argon2idTestHash("m=65536,t=3,p=0", 32)},
+		{name: "argon2id p overflow", hash: argon2idTestHash("m=65536,t=3,p=256", 32)},
+		{name: "argon2id m=0", hash: argon2idTestHash("m=0,t=3,p=4", 32)},
+		{name: "argon2id huge m", hash: argon2idTestHash("m=4294967295,t=3,p=4", 32)},
+		{name: "argon2id huge t", hash: argon2idTestHash("m=65536,t=1000000,p=4", 32)},
+		{name: "argon2id negative", hash: argon2idTestHash("m=-1,t=3,p=4", 32)},
+		{name: "argon2id params suffix", hash: argon2idTestHash("m=65536,t=3,p=4,x", 32)},
+		{name: "argon2id short key", hash: argon2idTestHash("m=65536,t=3,p=4", 8)},
+		{name: "argon2id long key", hash: argon2idTestHash("m=65536,t=3,p=4", 1024)},
+		{name: "bcrypt alphabet", hash: "$2a$10$" + strings.Repeat("!", 53)},
+		{name: "bcrypt cost", hash: "$2a$99$" + strings.Repeat("a", 53)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, err := verifyHash(tt.hash, "secret"); ok || !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("verifyHash() got = %v, err = %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestEncrypt_HashPrefixedPlainText(t *testing.T) {
+	cost := BcryptCost
+	BcryptCost = bcrypt.MinCost
+	t.Cleanup(func() { BcryptCost = cost })
+
+	db := newTestDB(t, &testLogin{})
+	// 以哈希前缀开头但不是合法哈希值的明文仍然需要哈希，不能原样保存
+	password := "$argon2id$v=19$m=65536,t=3,p=4$my$password"
+	pin := "$2a$10$" + strings.Repeat("!", 53)
+	login := testLogin{Name: "zhang", Password: password, Pin: pin}
+	if err := db.Create(&login).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got testLogin
+	if err := db.First(&got, login.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Password == password || got.Pin == pin {
+		t.Fatalf("Create() stored the plain text, got %+v", got)
+	}
+	if ok, err := Verify(&got, "Password", password); !ok || err != nil {
+		t.Errorf("Verify(Password) got = %v, err = %v", ok, err)
+	}
+	if ok, err := Verify(&got, "Pin", pin); !ok || err != nil {
+		t.Errorf("Verify(Pin) got = %v, err = %v", ok, err)
+	}
+}
@@ -0,0 +1,143 @@
+package callback
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// KeyProvider 主密钥提供者，负责包装/解包数据密钥，主密钥本身不离开提供者。
+// 生产环境对接 KMS，本地开发和测试使用 LocalKeyProvider
+type KeyProvider interface {
+	// CurrentKeyID 返回当前用于包装数据密钥的主密钥 ID
+	CurrentKeyID(ctx context.Context) (string, error)
+	// WrapKey 使用指定的主密钥包装数据密钥
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey 使用指定的主密钥解包数据密钥
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyResolver 可以按 ID 返回主密钥本身的 KeyProvider。ModeRandom、ModeDeterministic 直接使用主密钥加密，
+// 信封中的密钥 ID 通过它解析，轮换后旧的密钥 ID 仍然可以解密。LocalKeyProvider 实现了该接口，
+// KMS 中不可导出的主密钥只能用于 ModeEnvelope、ModeSubject
+type KeyResolver interface {
+	// Key 返回指定 ID 的主密钥
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// ErrKeyNotExportable KeyProvider 没有实现 KeyResolver，不能用于直接使用主密钥的加密模式
+var ErrKeyNotExportable = errors.New("encryption: key provider does not implement KeyResolver")
+
+// DefaultKeyProvider Config.KeyProvider 为空时使用的主密钥提供者，主密钥为 DATA_KEY
+var DefaultKeyProvider KeyProvider = NewLocalKeyProvider(DefaultKeyID, map[string][]byte{DefaultKeyID: DATA_KEY})
+
+// LocalKeyProvider 本地的 KMS 替身，使用 AES-GCM 以内存中的主密钥包装数据密钥
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalKeyProvider 创建本地主密钥提供者，current 为当前使用的主密钥 ID
+func NewLocalKeyProvider(current string, keys map[string][]byte) *LocalKeyProvider {
+	return &LocalKeyProvider{current: current, keys: keys}
+}
+
+// keyFile 主密钥文件格式，keys 中的主密钥为 base64 编码
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider 从 JSON 文件加载主密钥，文件不存在时生成一个随机的 AES-256 主密钥并写入文件，
+// 文件格式：{"current":"k1","keys":{"k1":"<base64>"}}。轮换主密钥时添加新的 key 并修改 current，旧 key 需要保留用于解密
+func NewFileKeyProvider(path string) (*LocalKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		kf := keyFile{Current: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString(key)}}
+		if data, err = json.MarshalIndent(kf, "", "  "); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+	keys := make(map[string][]byte, len(kf.Keys))
+	for id, encoded := range kf.Keys {
+		if keys[id], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("decode master key %s: %w", id, err)
+		}
+	}
+	if _, ok := keys[kf.Current]; !ok {
+		return nil, fmt.Errorf("current master key %q not found in %s", kf.Current, path)
+	}
+	return NewLocalKeyProvider(kf.Current, keys), nil
+}
+
+// CurrentKeyID implements KeyProvider
+func (p *LocalKeyProvider) CurrentKeyID(ctx context.Context) (string, error) {
+	return p.current, nil
+}
+
+// Key implements KeyResolver
+func (p *LocalKeyProvider) Key(ctx context.Context, keyID string) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption: unknown master key id %q", keyID)
+	}
+	return key, nil
+}
+
+// WrapKey implements KeyProvider，输出为 nonce + 密文
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := p.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+// UnwrapKey implements KeyProvider
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := p.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+func (p *LocalKeyProvider) aead(keyID string) (cipher.AEAD, error) {
+	key, err := p.Key(context.Background(), keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
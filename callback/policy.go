@@ -0,0 +1,86 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// 解密失败时的处理策略，通过 encryption:"true;on_error:lenient" 为字段单独指定，
+// 未指定时由 Config.FailOnDecryptError 决定（true 为 OnErrorStrict，false 为 OnErrorLenient）。
+// 对已有明文数据逐步开启加密时，先使用 lenient 读取混合数据，回填完成且失败计数归零后再切换为 strict
+const (
+	// OnErrorStrict 查询返回错误
+	OnErrorStrict = "strict"
+	// OnErrorLenient 字段保留数据库中的原始值，并通过 Config.OnDecryptError 报告
+	OnErrorLenient = "lenient"
+	// OnErrorNull 字段置为零值（指针、sql.NullString 为 NULL），并通过 Config.OnDecryptError 报告
+	OnErrorNull = "null"
+)
+
+// DecryptError 字段解密失败的信息，不包含字段的原始值
+type DecryptError struct {
+	Table  string
+	Column string
+	// Policy 本次失败采用的处理策略
+	Policy string
+	Err    error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("decrypt %s.%s: %v", e.Table, e.Column, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// decryptFailures 每张表的解密失败次数
+type decryptFailures struct {
+	counters sync.Map
+}
+
+func (f *decryptFailures) add(table string) {
+	counter, _ := f.counters.LoadOrStore(table, new(int64))
+	atomic.AddInt64(counter.(*int64), 1)
+}
+
+func (f *decryptFailures) snapshot() map[string]int64 {
+	result := map[string]int64{}
+	f.counters.Range(func(table, counter interface{}) bool {
+		result[table.(string)] = atomic.LoadInt64(counter.(*int64))
+		return true
+	})
+	return result
+}
+
+// onError 返回字段解密失败时使用的策略
+func (e *Encryptor) onError(opts fieldOptions) string {
+	switch opts.OnError {
+	case OnErrorStrict, OnErrorLenient, OnErrorNull:
+		return opts.OnError
+	case "":
+		if e.config.FailOnDecryptError {
+			return OnErrorStrict
+		}
+		return OnErrorLenient
+	}
+	// 无法识别的策略按最安全的 strict 处理
+	return OnErrorStrict
+}
+
+// decryptFailed 记录一次解密失败并返回处理策略，非 strict 策略会调用 Config.OnDecryptError
+func (e *Encryptor) decryptFailed(ctx context.Context, ef encryptedField, err error) *DecryptError {
+	decryptErr := &DecryptError{Table: ef.Field.Schema.Table, Column: ef.Field.DBName, Policy: e.onError(ef.Options), Err: err}
+	e.failures.add(decryptErr.Table)
+	if decryptErr.Policy != OnErrorStrict && e.config.OnDecryptError != nil {
+		e.config.OnDecryptError(ctx, decryptErr)
+	}
+	return decryptErr
+}
+
+// DecryptFailures 返回启动以来每张表的解密失败次数，key 为表名
+func (e *Encryptor) DecryptFailures() map[string]int64 {
+	return e.failures.snapshot()
+}
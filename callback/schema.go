@@ -0,0 +1,287 @@
+package callback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// cipherValue 扫描加密列时使用的中间值，字段的 Set 钩子识别到该类型后先解密再赋值
+type cipherValue struct {
+	Data  string
+	Valid bool
+}
+
+// Scan implements sql.Scanner
+func (c *cipherValue) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		c.Data, c.Valid = "", false
+	case []byte:
+		c.Data, c.Valid = string(v), true
+	case string:
+		c.Data, c.Valid = v, true
+	default:
+		return fmt.Errorf("encryption: unsupported ciphertext type %T", src)
+	}
+	return nil
+}
+
+// PrepareSchema 在查询执行前为模型和查询目标的 schema 安装解密钩子
+func (e *Encryptor) PrepareSchema(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if db.Statement.Schema != nil {
+		e.prepareSchema(db.Statement.Schema)
+	}
+	if db.Statement.Dest != nil && db.Statement.Dest != db.Statement.Model {
+		if sch, err := parseSchema(db, db.Statement.Dest); err == nil {
+			e.prepareSchema(sch)
+		}
+	}
+}
+
+// parseSchema 使用 db 的 schema 缓存解析模型，不修改 db.Statement
+func parseSchema(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// encryptedField schema 中带 encryption tag 的字段及其解析后的选项
+type encryptedField struct {
+	Field   *schema.Field
+	Options fieldOptions
+}
+
+var (
+	stringType     = reflect.TypeOf("")
+	bytesType      = reflect.TypeOf([]byte(nil))
+	nullStringType = reflect.TypeOf(sql.NullString{})
+)
+
+// plainTextOf 取出字段值中的明文，NULL（nil 指针、nil 切片、无效的 sql.NullString）返回 false
+func plainTextOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case *string:
+		if v == nil {
+			return "", false
+		}
+		return *v, true
+	case []byte:
+		if v == nil {
+			return "", false
+		}
+		return string(v), true
+	case sql.NullString:
+		return v.String, v.Valid
+	case *sql.NullString:
+		if v == nil || !v.Valid {
+			return "", false
+		}
+		return v.String, true
+	}
+	return "", false
+}
+
+// toFieldValue 将字符串转换为可以直接赋值给字段的值。*string 字段赋值为新的指针，不修改调用方指针指向的变量
+func (ef encryptedField) toFieldValue(text string) interface{} {
+	switch ef.Field.IndirectFieldType {
+	case bytesType:
+		return []byte(text)
+	case nullStringType:
+		return sql.NullString{String: text, Valid: true}
+	}
+	if ef.Field.FieldType.Kind() == reflect.Ptr {
+		return &text
+	}
+	return text
+}
+
+// isEncryptable 判断字段类型是否支持加密
+func isEncryptable(field *schema.Field) bool {
+	switch field.IndirectFieldType {
+	case stringType, bytesType, nullStringType:
+		return true
+	}
+	return field.IndirectFieldType.Kind() == reflect.String
+}
+
+// prepareSchema 返回 schema 中的加密字段，结果按 schema 缓存，每个 schema 只解析一次。
+// 首次解析时为加密字段（哈希字段除外）替换 NewValuePool 和 Set：从数据库扫描出的值先放入 cipherValue，赋值到结构体时解密。
+// 解密发生在扫描阶段，因此 Find/First、Raw().Scan()、Rows()+ScanRows() 扫描到结构体时都会解密
+func (e *Encryptor) prepareSchema(sch *schema.Schema) []encryptedField {
+	if fields, ok := e.preparedSchemas.Load(sch); ok {
+		return fields.([]encryptedField)
+	}
+	e.prepareMu.Lock()
+	defer e.prepareMu.Unlock()
+	if fields, ok := e.preparedSchemas.Load(sch); ok {
+		return fields.([]encryptedField)
+	}
+
+	var fields []encryptedField
+	for _, field := range sch.Fields {
+		if opts, ok := e.parseTag(field.Tag); ok && isEncryptable(field) {
+			ef := encryptedField{Field: field, Options: opts}
+			if opts.Mode != ModeHash {
+				e.hookField(ef)
+			}
+			fields = append(fields, ef)
+		}
+	}
+	e.preparedSchemas.Store(sch, fields)
+	e.schemasByTable.Store(sch.Table, sch)
+	return fields
+}
+
+// encryptedFieldOf 返回 schema 中指定字段的加密信息，字段不存在或未加密时返回 false
+func (e *Encryptor) encryptedFieldOf(sch *schema.Schema, name string) (encryptedField, bool) {
+	field := sch.LookUpField(name)
+	if field == nil {
+		return encryptedField{}, false
+	}
+	for _, ef := range e.prepareSchema(sch) {
+		if ef.Field == field {
+			return ef, true
+		}
+	}
+	return encryptedField{}, false
+}
+
+var cipherValuePool = &sync.Pool{
+	New: func() interface{} {
+		return new(cipherValue)
+	},
+}
+
+func (e *Encryptor) hookField(ef encryptedField) {
+	field, opts := ef.Field, ef.Options
+	set := field.Set
+	field.NewValuePool = cipherValuePool
+	field.Set = func(ctx context.Context, value reflect.Value, v interface{}) error {
+		c, ok := v.(*cipherValue)
+		if !ok {
+			return set(ctx, value, v)
+		}
+		if !c.Valid {
+			return set(ctx, value, nil)
+		}
+		plainText, err := e.decryptValue(ctx, opts, c.Data)
+		if err != nil {
+			switch decryptErr := e.decryptFailed(ctx, ef, err); decryptErr.Policy {
+			case OnErrorNull:
+				return set(ctx, value, nil)
+			case OnErrorLenient:
+				plainText = c.Data
+			default:
+				return decryptErr
+			}
+		} else {
+			e.recordAccess(ctx, field, value, "")
+		}
+		if field.IndirectFieldType == bytesType {
+			return set(ctx, value, []byte(plainText))
+		}
+		return set(ctx, value, plainText)
+	}
+}
+
+// lookupSchema 查找语句对应的 schema：优先使用模型解析出的 schema，其次按表名查找已注册的模型
+func (e *Encryptor) lookupSchema(db *gorm.DB) *schema.Schema {
+	if db.Statement.Schema != nil {
+		return db.Statement.Schema
+	}
+	if db.Statement.Table != "" {
+		if sch, ok := e.schemasByTable.Load(db.Statement.Table); ok {
+			return sch.(*schema.Schema)
+		}
+	}
+	return nil
+}
+
+// registerModels 预先解析模型并安装解密钩子，同时检查加密列的长度和 mode:subject 字段的主体字段。
+// Raw().Scan() 走 Row 回调链，执行时无法得知扫描目标，模型需要在此之前注册或已经被其他操作使用过
+func (e *Encryptor) registerModels(db *gorm.DB, models ...interface{}) error {
+	var errs []error
+	for _, model := range models {
+		sch, err := parseSchema(db, model)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fields := e.prepareSchema(sch)
+		for _, ef := range fields {
+			if ef.Options.Mode != ModeSubject {
+				continue
+			}
+			if _, err := subjectField(ef); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		e.checkColumnSize(db, fields)
+	}
+	return errors.Join(errs...)
+}
+
+// envelopeWrappedKeySize LocalKeyProvider 包装后的数据密钥长度（nonce + 32 字节密钥 + tag），KMS 包装的结果通常更长
+const envelopeWrappedKeySize = 12 + 32 + 16
+
+// cipherTextSize 估算不超过 size 字节的明文加密后的最大长度，信封模式按 LocalKeyProvider 估算，是下限
+func (e *Encryptor) cipherTextSize(ctx context.Context, opts fieldOptions, size int) int {
+	base64Size := func(n int) int { return (n + 2) / 3 * 4 }
+	prefix := func(algorithm, keyID string) int {
+		return len(newEnvelope(algorithm, keyID, "").String())
+	}
+	keyID, _ := e.keyProvider().CurrentKeyID(ctx)
+	switch opts.Mode {
+	case ModeHash:
+		return hashSize(opts.Hash)
+	case ModeToken:
+		return size
+	case ModeDeterministic:
+		return prefix(AlgAESSIV, keyID) + base64Size(16+size)
+	case ModeSubject:
+		// 主体 ID 的长度未知，按 20 位数字的主键估算
+		return prefix(AlgSubject, strings.Repeat("0", 20)) + base64Size(12+size+16)
+	case ModeEnvelope:
+		return prefix(AlgDataKey, keyID) + base64Size(envelopeWrappedKeySize) + 1 + base64Size(12+size+16)
+	default:
+		return prefix(AlgAESCBC, keyID) + base64Size(16+(size/16+1)*16)
+	}
+}
+
+// checkColumnSize 加密字段通过 gorm:"size:xxx" 指定了列长度且放不下密文时输出警告，
+// 此时 AutoMigrate 创建的列太短，写入时会被截断或报错。密文长度按 encryption tag 中的 plain_size 估算，
+// 未指定 plain_size 时按空字符串的密文长度估算，只能发现连最短的密文都放不下的列
+func (e *Encryptor) checkColumnSize(db *gorm.DB, fields []encryptedField) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, ef := range fields {
+		if ef.Field.Size <= 0 {
+			continue
+		}
+		plainSize := ef.Options.PlainSize
+		if plainSize <= 0 && ef.Options.Mode == ModeToken {
+			plainSize = ef.Field.Size
+		}
+		if need := e.cipherTextSize(ctx, ef.Options, plainSize); need > ef.Field.Size {
+			db.Logger.Warn(ctx, "encryption: column %s.%s has size %d but mode %s needs at least %d, use mode:token or enlarge the column",
+				ef.Field.Schema.Table, ef.Field.DBName, ef.Field.Size, ef.Options.Mode, need)
+		}
+	}
+}
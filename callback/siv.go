@@ -0,0 +1,176 @@
+package callback
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+)
+
+// sivKeyLabel 用于从主密钥派生 AES-SIV 密钥，避免确定性模式与随机模式共用同一把密钥
+var sivKeyLabel = []byte("gorm-learning:aes-siv")
+
+// deriveSivKey 使用 HMAC-SHA256 派生 32 字节的 AES-SIV 密钥（前 16 字节用于 CMAC，后 16 字节用于 CTR）
+func deriveSivKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(sivKeyLabel)
+	return mac.Sum(nil)
+}
+
+// AesSivEncrypt AES-SIV (RFC 5297) 加密，相同的明文和密钥总是得到相同的密文
+func AesSivEncrypt(plainText, key []byte) (string, error) {
+	cipherText, err := sivSeal(deriveSivKey(key), plainText)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+// AesSivDecrypt AES-SIV (RFC 5297) 解密，并校验合成 IV
+func AesSivDecrypt(cipherText string, key []byte) (string, error) {
+	cipherData, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", err
+	}
+	plainText, err := sivOpen(deriveSivKey(key), cipherData)
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+// sivSeal 按 RFC 5297 加密：输出为 16 字节的合成 IV + CTR 密文
+func sivSeal(key, plainText []byte, associatedData ...[]byte) ([]byte, error) {
+	macBlock, ctrBlock, err := sivBlocks(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := s2v(macBlock, plainText, associatedData...)
+	out := make([]byte, aes.BlockSize+len(plainText))
+	copy(out, v)
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(out[aes.BlockSize:], plainText)
+	return out, nil
+}
+
+// sivOpen 按 RFC 5297 解密，合成 IV 不一致时返回错误
+func sivOpen(key, cipherData []byte, associatedData ...[]byte) ([]byte, error) {
+	if len(cipherData) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	macBlock, ctrBlock, err := sivBlocks(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := cipherData[:aes.BlockSize]
+	plainText := make([]byte, len(cipherData)-aes.BlockSize)
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(plainText, cipherData[aes.BlockSize:])
+	if subtle.ConstantTimeCompare(v, s2v(macBlock, plainText, associatedData...)) != 1 {
+		return nil, errors.New("siv: message authentication failed")
+	}
+	return plainText, nil
+}
+
+// sivBlocks 将 SIV 密钥拆分为 CMAC 和 CTR 两部分
+func sivBlocks(key []byte) (macBlock, ctrBlock cipher.Block, err error) {
+	if len(key) != 32 && len(key) != 48 && len(key) != 64 {
+		return nil, nil, errors.New("siv: invalid key size")
+	}
+	if macBlock, err = aes.NewCipher(key[:len(key)/2]); err != nil {
+		return nil, nil, err
+	}
+	if ctrBlock, err = aes.NewCipher(key[len(key)/2:]); err != nil {
+		return nil, nil, err
+	}
+	return macBlock, ctrBlock, nil
+}
+
+// sivCounter 按 RFC 5297 清除合成 IV 中第 63 位和第 31 位后作为 CTR 初始计数器
+func sivCounter(v []byte) []byte {
+	q := make([]byte, aes.BlockSize)
+	copy(q, v)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	return q
+}
+
+// s2v 伪随机函数 S2V，输入为关联数据和明文
+func s2v(block cipher.Block, plainText []byte, associatedData ...[]byte) []byte {
+	d := cmac(block, make([]byte, aes.BlockSize))
+	for _, ad := range associatedData {
+		d = xorBlock(dbl(d), cmac(block, ad))
+	}
+
+	var t []byte
+	if len(plainText) >= aes.BlockSize {
+		t = make([]byte, len(plainText))
+		copy(t, plainText)
+		tail := t[len(t)-aes.BlockSize:]
+		copy(tail, xorBlock(tail, d))
+	} else {
+		padded := make([]byte, aes.BlockSize)
+		copy(padded, plainText)
+		padded[len(plainText)] = 0x80
+		t = xorBlock(dbl(d), padded)
+	}
+	return cmac(block, t)
+}
+
+// cmac 计算 AES-CMAC (RFC 4493)
+func cmac(block cipher.Block, data []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = dbl(k1)
+	k2 := dbl(k1)
+
+	n := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(data)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	if complete {
+		copy(last, xorBlock(data[(n-1)*aes.BlockSize:], k1))
+	} else {
+		copy(last, data[(n-1)*aes.BlockSize:])
+		last[len(data)-(n-1)*aes.BlockSize] = 0x80
+		last = xorBlock(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		x = xorBlock(x, data[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	x = xorBlock(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+// dbl 在 GF(2^128) 上乘以 x
+func dbl(b []byte) []byte {
+	out := make([]byte, len(b))
+	var carry byte
+	for i := len(b) - 1; i >= 0; i-- {
+		out[i] = b[i]<<1 | carry
+		carry = b[i] >> 7
+	}
+	if b[0]&0x80 != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+	return out
+}
+
+// xorBlock 返回 a 与 b 按位异或后的新切片，长度以 a 为准
+func xorBlock(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
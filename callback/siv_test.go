@@ -0,0 +1,87 @@
+package callback
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 5297 A.1 Deterministic Authenticated Encryption Example
+func TestSivSeal_RFC5297(t *testing.T) {
+	key := mustHex(t, "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	ad := mustHex(t, "101112131415161718191a1b1c1d1e1f2021222324252627")
+	plainText := mustHex(t, "112233445566778899aabbccddee")
+	want := mustHex(t, "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c")
+
+	got, err := sivSeal(key, plainText, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("sivSeal() got = %x, want %x", got, want)
+	}
+
+	opened, err := sivOpen(key, got, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plainText) {
+		t.Errorf("sivOpen() got = %x, want %x", opened, plainText)
+	}
+}
+
+func TestAesSivEncrypt(t *testing.T) {
+	tests := []struct {
+		name      string
+		plainText string
+	}{
+		{name: "empty", plainText: ""},
+		{name: "phone", plainText: "18601774393"},
+		{name: "oneBlock", plainText: "0123456789abcdef"},
+		{name: "multiBlock", plainText: "89954554554@163.com-zhangshenglu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := AesSivEncrypt([]byte(tt.plainText), DATA_KEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := AesSivEncrypt([]byte(tt.plainText), DATA_KEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first != second {
+				t.Errorf("AesSivEncrypt() is not deterministic: %v != %v", first, second)
+			}
+			got, err := AesSivDecrypt(first, DATA_KEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.plainText {
+				t.Errorf("AesSivDecrypt() got = %v, want %v", got, tt.plainText)
+			}
+		})
+	}
+}
+
+func TestAesSivDecrypt_Tampered(t *testing.T) {
+	cipherText, err := AesSivEncrypt([]byte("18601774393"), DATA_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AesSivDecrypt(cipherText, []byte("6543210987654321")); err == nil {
+		t.Errorf("AesSivDecrypt() with wrong key expected error")
+	}
+	if _, err := AesSivDecrypt("AAAA", DATA_KEY); err == nil {
+		t.Errorf("AesSivDecrypt() with short ciphertext expected error")
+	}
+}
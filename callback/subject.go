@@ -0,0 +1,283 @@
+package callback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// AlgSubject 主体密钥模式的算法标识：AES-256-GCM，信封中的密钥 ID 为主体 ID，载荷为 nonce+密文，
+// 数据密钥由主密钥包装后保存在 SubjectKeyStore 中，不与密文存储在一起
+const AlgSubject = "sub"
+
+// subjectIDMaxLen 主体 ID 的最大长度，与 SubjectKey.SubjectID 的列长度一致
+const subjectIDMaxLen = 64
+
+var (
+	// ErrNoSubject mode:subject 字段写入时所在记录的主体字段为零值
+	ErrNoSubject = errors.New("encryption: subject of mode:subject field is empty")
+	// ErrSubjectErased 主体的密钥不存在，通常是已经通过 Erase 销毁
+	ErrSubjectErased = errors.New("encryption: subject key not found, the subject may have been erased")
+	// ErrNoSubjectKeyStore 使用 mode:subject 字段但没有配置 Config.SubjectKeys
+	ErrNoSubjectKeyStore = errors.New("encryption: mode:subject requires Config.SubjectKeys")
+	// ErrAutoIncrementSubject mode:subject 字段的主体是自增主键，新增时还没有主键值，需要通过 subject:xxx 指定其他字段
+	// 或者改为由应用生成主键（例如 idgen 的 autoIncrement:false 主键）
+	ErrAutoIncrementSubject = errors.New("encryption: subject of mode:subject field can not be an auto-increment primary key")
+)
+
+// SubjectKey encryption_subject_keys 表的记录，WrappedKey 为主密钥 KeyID 包装后的数据密钥（base64）
+type SubjectKey struct {
+	SubjectID  string `gorm:"primaryKey;size:64"`
+	KeyID      string `gorm:"size:64"`
+	WrappedKey string `gorm:"size:255"`
+	CreatedAt  time.Time
+}
+
+// TableName 主体密钥表名
+func (SubjectKey) TableName() string {
+	return "encryption_subject_keys"
+}
+
+// SubjectKeyStore 保存每个主体（通常是用户）的数据密钥，通过 Config.SubjectKeys 配置。
+// 密钥表应与业务数据分开存放和备份（独立的库或更短的备份保留期），否则旧备份中的密钥仍然可以解密旧备份中的数据。
+// 查询扫描加密字段时会读取密钥表，db 应使用独立的连接池，不要与执行查询的事务共用连接
+type SubjectKeyStore struct {
+	db *gorm.DB
+}
+
+// MigrateSubjectKeys 创建或更新 encryption_subject_keys 表，部署时执行一次，NewSubjectKeyStore 不会建表
+func MigrateSubjectKeys(db *gorm.DB) error {
+	return db.AutoMigrate(&SubjectKey{})
+}
+
+// NewSubjectKeyStore 使用 db 中的主体密钥表，表需要先通过 MigrateSubjectKeys 创建
+func NewSubjectKeyStore(db *gorm.DB) (*SubjectKeyStore, error) {
+	return &SubjectKeyStore{db: db.Session(&gorm.Session{NewDB: true})}, nil
+}
+
+// load 读取主体的密钥，不存在时返回 nil
+func (s *SubjectKeyStore) load(ctx context.Context, subjectID string) (*SubjectKey, error) {
+	var keys []SubjectKey
+	if err := s.db.WithContext(ctx).Where("subject_id = ?", subjectID).Limit(1).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return &keys[0], nil
+}
+
+// create 保存主体的密钥，并发写入同一个主体时以先写入的为准，返回最终保存的密钥
+func (s *SubjectKeyStore) create(ctx context.Context, key SubjectKey) (*SubjectKey, error) {
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&key).Error; err != nil {
+		return nil, err
+	}
+	stored, err := s.load(ctx, key.SubjectID)
+	if err == nil && stored == nil {
+		err = ErrSubjectErased
+	}
+	return stored, err
+}
+
+// delete 删除主体的密钥
+func (s *SubjectKeyStore) delete(ctx context.Context, subjectID string) error {
+	return s.db.WithContext(ctx).Where("subject_id = ?", subjectID).Delete(&SubjectKey{}).Error
+}
+
+func subjectCacheID(subjectID string) string {
+	return AlgSubject + envelopeSep + subjectID
+}
+
+// subjectKey 返回主体的数据密钥（优先使用缓存），create 为 true 时不存在则生成新的密钥
+func (e *Encryptor) subjectKey(ctx context.Context, subjectID string, create bool) (*dataKey, error) {
+	store := e.config.SubjectKeys
+	if store == nil {
+		return nil, ErrNoSubjectKeyStore
+	}
+	if key, ok := e.unwrappedKeys.get(subjectCacheID(subjectID)); ok {
+		return key, nil
+	}
+	record, err := store.load(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		if !create {
+			return nil, ErrSubjectErased
+		}
+		key, err := e.generateDataKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		record, err = store.create(ctx, SubjectKey{
+			SubjectID:  subjectID,
+			KeyID:      key.KeyID,
+			WrappedKey: base64.StdEncoding.EncodeToString(key.Wrapped),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(record.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := e.keyProvider().UnwrapKey(ctx, record.KeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	key := &dataKey{KeyID: record.KeyID, Plain: plain, Wrapped: wrapped}
+	e.unwrappedKeys.put(subjectCacheID(subjectID), key)
+	return key, nil
+}
+
+// sealSubject 使用主体的数据密钥加密，主体 ID 作为附加数据，密文不能被挪到其他主体的记录中解密
+func (e *Encryptor) sealSubject(ctx context.Context, subjectID, plainText string) (string, error) {
+	key, err := e.subjectKey(ctx, subjectID, true)
+	if err != nil {
+		return "", err
+	}
+	aead, err := dataKeyAEAD(key.Plain)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plainText), []byte(subjectID))), nil
+}
+
+// openSubject 解密主体密钥模式的信封载荷，主体已经被擦除时返回 ErrSubjectErased
+func (e *Encryptor) openSubject(ctx context.Context, subjectID, payload string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	key, err := e.subjectKey(ctx, subjectID, false)
+	if err != nil {
+		return "", err
+	}
+	aead, err := dataKeyAEAD(key.Plain)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encryption: ciphertext too short")
+	}
+	plainText, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(subjectID))
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+// subjectField 返回 mode:subject 字段的主体字段，未通过 subject:xxx 指定时为主键，主键是自增主键时返回 ErrAutoIncrementSubject
+func subjectField(ef encryptedField) (*schema.Field, error) {
+	if ef.Options.Subject == "" {
+		field := ef.Field.Schema.PrioritizedPrimaryField
+		switch {
+		case field == nil:
+			return nil, fmt.Errorf("encryption: %s has no primary key for mode:subject field %s", ef.Field.Schema.Name, ef.Field.Name)
+		case field.AutoIncrement:
+			return nil, fmt.Errorf("%w: %s.%s", ErrAutoIncrementSubject, ef.Field.Schema.Name, ef.Field.Name)
+		}
+		return field, nil
+	}
+	if field := ef.Field.Schema.LookUpField(ef.Options.Subject); field != nil {
+		return field, nil
+	}
+	return nil, fmt.Errorf("encryption: subject field %s of %s.%s not found", ef.Options.Subject, ef.Field.Schema.Name, ef.Field.Name)
+}
+
+// subjectIDOf 将主体字段的值格式化为主体 ID
+func subjectIDOf(value interface{}) (string, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if !rv.IsValid() {
+		return "", ErrNoSubject
+	}
+	id := fmt.Sprint(rv.Interface())
+	switch {
+	case id == "":
+		return "", ErrNoSubject
+	case len(id) > subjectIDMaxLen || strings.Contains(id, envelopeSep):
+		return "", fmt.Errorf("encryption: invalid subject id %q", id)
+	}
+	return id, nil
+}
+
+// subjectOf 读取记录 rv 中 mode:subject 字段的主体 ID。rv 中主体字段为零值时（例如 Updates 传入的结构体只包含部分字段）
+// 使用语句 Model 中的值，Model 中也没有时返回 ErrNoSubject
+func (e *Encryptor) subjectOf(db *gorm.DB, ef encryptedField, rv reflect.Value) (string, error) {
+	field, err := subjectField(ef)
+	if err != nil {
+		return "", err
+	}
+	value, zero := field.ValueOf(db.Statement.Context, rv)
+	if zero {
+		return e.subjectOfModel(db, field)
+	}
+	return subjectIDOf(value)
+}
+
+// subjectOfMap 读取 map 中 mode:subject 字段的主体 ID，map 中没有主体字段时使用语句 Model 中的值
+func (e *Encryptor) subjectOfMap(db *gorm.DB, ef encryptedField, m map[string]interface{}) (string, error) {
+	field, err := subjectField(ef)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range []string{field.Name, field.DBName} {
+		if value, ok := m[key]; ok && value != nil {
+			return subjectIDOf(value)
+		}
+	}
+	return e.subjectOfModel(db, field)
+}
+
+func (e *Encryptor) subjectOfModel(db *gorm.DB, field *schema.Field) (string, error) {
+	rv := db.Statement.ReflectValue
+	if db.Statement.Schema == nil || rv.Kind() != reflect.Struct {
+		return "", ErrNoSubject
+	}
+	modelField := db.Statement.Schema.LookUpField(field.Name)
+	if modelField == nil {
+		return "", ErrNoSubject
+	}
+	value, zero := modelField.ValueOf(db.Statement.Context, rv)
+	if zero {
+		return "", ErrNoSubject
+	}
+	return subjectIDOf(value)
+}
+
+// Erase 销毁主体的数据密钥（crypto-shredding）：该主体所有 mode:subject 字段的密文，包括旧备份中的密文都无法再解密，
+// 解密时按字段的 on_error 策略处理 ErrSubjectErased，建议 mode:subject 字段使用 on_error:null。
+// 其他进程中缓存的密钥在 DataKeyTTL 后失效。擦除后再写入该主体的数据会生成新的密钥
+func (e *Encryptor) Erase(ctx context.Context, subjectID string) error {
+	store := e.config.SubjectKeys
+	if store == nil {
+		return ErrNoSubjectKeyStore
+	}
+	err := store.delete(ctx, subjectID)
+	e.unwrappedKeys.delete(subjectCacheID(subjectID))
+	return err
+}
+
+// Erase 使用 db 上注册的 Encryptor 销毁主体的数据密钥，见 Encryptor.Erase
+func Erase(db *gorm.DB, subjectID string) error {
+	return encryptorOf(db).Erase(db.Statement.Context, subjectID)
+}
@@ -0,0 +1,143 @@
+package callback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type testMember struct {
+	ID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name  string `gorm:"size:32"`
+	Email string `encryption:"mode:subject;on_error:null"`
+}
+
+type testOrder struct {
+	ID       uint `gorm:"primaryKey"`
+	MemberID uint
+	Address  string `encryption:"mode:subject;subject:MemberID;on_error:null"`
+}
+
+// testAutoMember 以自增主键作为 mode:subject 字段的主体，新增时还没有主体
+type testAutoMember struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `encryption:"mode:subject"`
+}
+
+// newSubjectDB 创建配置了主体密钥的内存数据库，密钥表保存在另一个内存数据库中
+func newSubjectDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	keyDB := newTestDB(t)
+	if err := MigrateSubjectKeys(keyDB); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSubjectKeyStore(keyDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(Config{SubjectKeys: store, FailOnDecryptError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newEncryptorDB(t, e, &testMember{}, &testOrder{})
+}
+
+func TestEncrypt_Subject(t *testing.T) {
+	db := newSubjectDB(t)
+	members := []testMember{{ID: 1, Name: "zhang", Email: "zhang@163.com"}, {ID: 2, Name: "li", Email: "li@163.com"}}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testOrder{MemberID: 1, Address: "shanghai"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&members[0]).Updates(map[string]interface{}{"email": "zhang@126.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raws []string
+	db.Raw("SELECT email FROM test_members WHERE id = 1 UNION ALL SELECT address FROM test_orders").Scan(&raws)
+	if len(raws) != 2 {
+		t.Fatalf("Raw() got = %v", raws)
+	}
+	for _, raw := range raws {
+		if !strings.HasPrefix(raw, "enc:1:sub:1:") {
+			t.Errorf("value should be encrypted with the key of subject 1, got %v", raw)
+		}
+	}
+	if err := db.Create(&testOrder{Address: "beijing"}).Error; !errors.Is(err, ErrNoSubject) {
+		t.Errorf("Create() without subject err = %v, want %v", err, ErrNoSubject)
+	}
+
+	if err := Erase(db, "1"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		dest interface{}
+		id   uint
+		get  func(dest interface{}) string
+		want string
+	}{
+		{name: "erased member", dest: &testMember{}, id: 1, get: func(d interface{}) string { return d.(*testMember).Email }, want: ""},
+		{name: "erased order", dest: &testOrder{}, id: 1, get: func(d interface{}) string { return d.(*testOrder).Address }, want: ""},
+		{name: "other member", dest: &testMember{}, id: 2, get: func(d interface{}) string { return d.(*testMember).Email }, want: "li@163.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.First(tt.dest, tt.id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.get(tt.dest); got != tt.want {
+				t.Errorf("First() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := DecryptFailures(db); got["test_members"] != 1 || got["test_orders"] != 1 {
+		t.Errorf("DecryptFailures() got = %v", got)
+	}
+	if _, err := DecryptField(db, &testMember{}, "Email", raws[0]); !errors.Is(err, ErrSubjectErased) {
+		t.Errorf("DecryptField() err = %v, want %v", err, ErrSubjectErased)
+	}
+}
+
+func TestBackfill_Subject(t *testing.T) {
+	db := newSubjectDB(t)
+	if err := db.Exec("INSERT INTO test_orders (id, member_id, address) VALUES (1, 7, 'shanghai'), (2, 8, 'beijing')").Error; err != nil {
+		t.Fatal(err)
+	}
+	got, err := Backfill(db, &testOrder{}, BackfillOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Updated != 2 {
+		t.Errorf("Backfill() updated = %v, want 2", got.Updated)
+	}
+	var raw string
+	db.Raw("SELECT address FROM test_orders WHERE id = 2").Scan(&raw)
+	if !strings.HasPrefix(raw, "enc:1:sub:8:") {
+		t.Errorf("Backfill() should use the key of the member, got %v", raw)
+	}
+}
+
+func TestEncrypt_SubjectWithoutStore(t *testing.T) {
+	db := newTestDB(t, &testMember{})
+	if err := db.Create(&testMember{ID: 1, Email: "zhang@163.com"}).Error; !errors.Is(err, ErrNoSubjectKeyStore) {
+		t.Errorf("Create() err = %v, want %v", err, ErrNoSubjectKeyStore)
+	}
+}
+
+func TestEncrypt_SubjectAutoIncrement(t *testing.T) {
+	db := newSubjectDB(t)
+	if err := encryptorOf(db).registerModels(db, &testAutoMember{}); !errors.Is(err, ErrAutoIncrementSubject) {
+		t.Errorf("registerModels() err = %v, want %v", err, ErrAutoIncrementSubject)
+	}
+	if err := db.AutoMigrate(&testAutoMember{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testAutoMember{Email: "zhang@163.com"}).Error; !errors.Is(err, ErrAutoIncrementSubject) {
+		t.Errorf("Create() err = %v, want %v", err, ErrAutoIncrementSubject)
+	}
+}
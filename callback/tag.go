@@ -0,0 +1,220 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// EncryptionTag 标记需要加解密字段的 struct tag 名称
+const EncryptionTag = "encryption"
+
+// encryption tag 支持的加密模式，通过 encryption:"mode:xxx" 指定，encryption:"true" 等同于 ModeRandom
+const (
+	// ModeRandom 随机模式（默认）：AES-CBC + 随机 IV，相同明文每次加密得到不同的密文。
+	// 不泄露任何关于明文的信息，但不能对密文建立唯一索引，也不能用密文做 WHERE 等值查询。
+	ModeRandom = "random"
+
+	// ModeDeterministic 确定性模式：AES-SIV，同一密钥下相同明文总是得到相同密文，
+	// 因此可以对密文建立唯一索引，结构体/map 条件中的等值查询也会自动加密参数后匹配。
+	// 代价是会泄露“两条记录的值是否相等”以及每个值出现的频率：低基数字段（性别、省份等）
+	// 可以通过频率分析还原明文，只应在确实需要唯一约束或等值查询的高基数字段上开启，
+	// 且不支持 LIKE、范围查询和排序。
+	ModeDeterministic = "deterministic"
+
+	// ModeEnvelope 信封模式：每条记录（或每张表，见 ScopeTable）生成随机的数据密钥，以 AES-256-GCM 加密字段，
+	// 数据密钥由 Config.KeyProvider（默认 DefaultKeyProvider）的主密钥包装后与密文存储在一起。单个数据密钥泄露只影响对应的记录，
+	// 主密钥保存在 KMS 中不落库；代价是密文更长，读取新的数据密钥时需要调用一次 KMS 解包（结果缓存 DataKeyTTL）
+	ModeEnvelope = "envelope"
+
+	// ModeToken 令牌模式：FF1 格式保留加密（NIST SP 800-38G），只加密值中的数字，长度和非数字字符保持不变，
+	// 11 位手机号加密后仍是 11 位数字，可以放入原有的 size:11 列。与确定性模式一样支持等值查询和唯一索引，也有同样的泄露。
+	// 令牌没有信封前缀，无法与明文区分：已有明文只能通过 Backfill 的 PlaintextTokens 一次性迁移，迁移前读取会把明文当作令牌还原成错误的值；
+	// 令牌中不带密钥 ID，使用 KeyProvider 当前的主密钥，轮换主密钥需要重新生成全部令牌。值中至少需要 6 位数字
+	ModeToken = "token"
+
+	// ModeSubject 主体密钥模式：按主体（通常是用户）加密，同一主体的所有字段使用同一个数据密钥，
+	// 数据密钥由主密钥包装后保存在 Config.SubjectKeys 中。主体默认为记录的主键（不能是自增主键，见 ErrAutoIncrementSubject），其他表通过 subject:UserID 指定主体字段，
+	// 写入时主体字段不能为零值。Erase 销毁主体的密钥后该主体的密文（包括旧备份中的）都无法再解密，用于满足删除个人数据的要求。
+	// 与随机模式一样不支持等值查询
+	ModeSubject = "subject"
+)
+
+// ErrUnknownMode encryption tag 中指定了不支持的加密模式
+var ErrUnknownMode = errors.New("encryption: unknown mode")
+
+// fieldOptions encryption tag 解析后的字段选项
+type fieldOptions struct {
+	Mode  string
+	Scope string
+	// OnError 解密失败时的处理策略，为空时由 Config.FailOnDecryptError 决定
+	OnError string
+	// PlainSize 明文的最大字节数，通过 plain_size:11 指定，只用于检查列长度是否放得下密文
+	PlainSize int
+	// Hash 哈希字段的算法，见 HashTag，只有 ModeHash 使用
+	Hash string
+	// Subject 主体字段名，通过 subject:UserID 指定，为空时为主键，只有 ModeSubject 使用
+	Subject string
+}
+
+// parseTag 解析加密 tag，例如 encryption:"true" 或 encryption:"mode:deterministic"，
+// encryption:"true" 使用 Config.Algorithm 指定的模式，第二个返回值表示该字段是否需要加解密。
+// 带 hash tag 的字段解析为 ModeHash，忽略 encryption tag
+func (e *Encryptor) parseTag(tag reflect.StructTag) (fieldOptions, bool) {
+	if algorithm, ok := tag.Lookup(HashTag); ok && algorithm != "" && algorithm != "-" {
+		return fieldOptions{Mode: ModeHash, Hash: strings.ToLower(algorithm)}, true
+	}
+	value, ok := tag.Lookup(e.config.TagName)
+	if !ok || value == "" || value == "-" || strings.EqualFold(value, "false") {
+		return fieldOptions{}, false
+	}
+
+	settings := schema.ParseTagSetting(value, ";")
+	opts := fieldOptions{Mode: e.config.Algorithm}
+	if mode, ok := settings["MODE"]; ok {
+		opts.Mode = strings.ToLower(mode)
+	} else if _, ok := settings["TRUE"]; !ok {
+		return fieldOptions{}, false
+	}
+	if onError, ok := settings["ON_ERROR"]; ok {
+		opts.OnError = strings.ToLower(onError)
+	}
+	if size, err := strconv.Atoi(settings["PLAIN_SIZE"]); err == nil {
+		opts.PlainSize = size
+	}
+	if opts.Mode == ModeSubject {
+		opts.Subject = settings["SUBJECT"]
+	}
+	if opts.Mode == ModeEnvelope {
+		opts.Scope = ScopeRow
+		if scope, ok := settings["SCOPE"]; ok {
+			opts.Scope = strings.ToLower(scope)
+		}
+	}
+	return opts, true
+}
+
+// encryptValue 按字段选项加密明文，返回信封格式的密文。keys 为当前记录共享的数据密钥状态，只有信封模式使用
+func (e *Encryptor) encryptValue(ctx context.Context, opts fieldOptions, plainText string, keys *rowKeys) (string, error) {
+	var (
+		algorithm, payload, keyID string
+		err                       error
+	)
+	switch opts.Mode {
+	case ModeDeterministic, ModeRandom:
+		var key []byte
+		if keyID, key, err = e.currentKey(ctx); err != nil {
+			return "", err
+		}
+		if opts.Mode == ModeDeterministic {
+			algorithm = AlgAESSIV
+			payload, err = AesSivEncrypt([]byte(plainText), key)
+		} else {
+			algorithm = AlgAESCBC
+			payload, err = AesEncrypt([]byte(plainText), key)
+		}
+	case ModeToken:
+		return e.tokenize(ctx, plainText)
+	case ModeSubject:
+		if keys == nil || keys.subject == "" {
+			return "", ErrNoSubject
+		}
+		algorithm, keyID = AlgSubject, keys.subject
+		payload, err = e.sealSubject(ctx, keys.subject, plainText)
+	case ModeEnvelope:
+		if keys == nil {
+			keys = newRowKeys("")
+		}
+		var key *dataKey
+		if key, err = e.rowDataKey(ctx, keys, opts.Scope); err != nil {
+			return "", err
+		}
+		algorithm, keyID = AlgDataKey, key.KeyID
+		payload, err = sealDataKey(key, plainText)
+	default:
+		return "", ErrUnknownMode
+	}
+	if err != nil {
+		return "", err
+	}
+	return newEnvelope(algorithm, keyID, payload).String(), nil
+}
+
+// sealValue 写入前加密字段值：已经是信封密文或哈希值的值原样返回，避免重复加密（令牌模式无法识别，总是加密），
+// 其他值都按明文加密。第二个返回值表示值是否发生了变化
+func (e *Encryptor) sealValue(ctx context.Context, opts fieldOptions, value string, keys *rowKeys) (string, bool, error) {
+	switch opts.Mode {
+	case ModeHash:
+		if DetectFormat(value, opts.Mode) == FormatHash {
+			return value, false, nil
+		}
+		hash, err := hashValue(opts.Hash, value)
+		return hash, err == nil, err
+	case ModeToken:
+		token, err := e.tokenize(ctx, value)
+		return token, err == nil, err
+	}
+	if DetectFormat(value, opts.Mode) == FormatEnvelope {
+		return value, false, nil
+	}
+	cipherText, err := e.encryptValue(ctx, opts, value, keys)
+	if err != nil {
+		return "", false, err
+	}
+	return cipherText, true, nil
+}
+
+// decryptValue 解密字段值。信封密文按信封中的算法和密钥 ID 解密，没有信封前缀的值只在开启 Config.DecryptLegacy 时按旧格式解密
+func (e *Encryptor) decryptValue(ctx context.Context, opts fieldOptions, cipherText string) (string, error) {
+	switch opts.Mode {
+	case ModeToken:
+		return e.detokenize(ctx, cipherText)
+	case ModeHash:
+		return "", ErrHashField
+	}
+	env, ok := parseEnvelope(cipherText)
+	if !ok {
+		if !e.config.DecryptLegacy {
+			return "", ErrNotEnvelope
+		}
+		return e.decryptLegacy(ctx, opts.Mode, cipherText)
+	}
+	switch env.Algorithm {
+	case AlgDataKey:
+		return e.openDataKey(ctx, env.KeyID, env.Payload)
+	case AlgSubject:
+		return e.openSubject(ctx, env.KeyID, env.Payload)
+	}
+	key, err := e.keyByID(ctx, env.KeyID)
+	if err != nil {
+		return "", err
+	}
+	switch env.Algorithm {
+	case AlgAESSIV:
+		return AesSivDecrypt(env.Payload, key)
+	case AlgAESCBC:
+		return AesDecrypt(env.Payload, key)
+	default:
+		return "", fmt.Errorf("encryption: unknown algorithm %q", env.Algorithm)
+	}
+}
+
+// EncryptDeterministic 使用确定性模式加密明文，用于手写 SQL 条件中与 mode:deterministic 字段做等值匹配，
+// 使用 db 上注册的 Encryptor 的主密钥，例如：
+//
+//	phone, _ := callback.EncryptDeterministic(db, "18601774393")
+//	db.Where("phone = ?", phone).First(&student)
+func EncryptDeterministic(db *gorm.DB, plainText string) (string, error) {
+	return encryptorOf(db).EncryptDeterministic(db.Statement.Context, plainText)
+}
+
+// EncryptDeterministic 见包级函数 EncryptDeterministic
+func (e *Encryptor) EncryptDeterministic(ctx context.Context, plainText string) (string, error) {
+	return e.encryptValue(ctx, fieldOptions{Mode: ModeDeterministic}, plainText, nil)
+}
@@ -0,0 +1,51 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// tokenize 使用 FF1 加密值中的数字，非数字字符保留在原来的位置，见 ModeToken。
+// 令牌中不带密钥 ID，FF1 密钥由 KeyProvider 当前的主密钥派生
+func (e *Encryptor) tokenize(ctx context.Context, plainText string) (string, error) {
+	_, key, err := e.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return transformDigits(plainText, deriveFF1Key(key), FF1Encrypt)
+}
+
+// detokenize 还原 tokenize 生成的令牌
+func (e *Encryptor) detokenize(ctx context.Context, token string) (string, error) {
+	_, key, err := e.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return transformDigits(token, deriveFF1Key(key), FF1Decrypt)
+}
+
+func transformDigits(value string, key []byte, transform func(key, tweak []byte, digits string) (string, error)) (string, error) {
+	var digits strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] >= '0' && value[i] <= '9' {
+			digits.WriteByte(value[i])
+		}
+	}
+	if digits.Len() < ff1MinLength {
+		return "", errors.New("encryption: token mode requires at least 6 digits")
+	}
+	result, err := transform(key, nil, digits.String())
+	if err != nil {
+		return "", err
+	}
+
+	out := []byte(value)
+	for i, j := 0, 0; i < len(out); i++ {
+		if out[i] >= '0' && out[i] <= '9' {
+			out[i] = result[j]
+			j++
+		}
+	}
+	return string(out), nil
+}
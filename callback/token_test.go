@@ -0,0 +1,106 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm/logger"
+)
+
+type testPhone struct {
+	ID        uint   `gorm:"primaryKey"`
+	Phone     string `gorm:"size:11;uniqueIndex" encryption:"mode:token"`
+	Formatted string `gorm:"size:16" encryption:"mode:token"`
+}
+
+func TestEncrypt_Token(t *testing.T) {
+	db := newTestDB(t, &testPhone{})
+	phone := testPhone{Phone: "18601774393", Formatted: "+86 186-0177-4393"}
+	if err := db.Create(&phone).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw testPhone
+	db.Table("test_phones").Select("phone, formatted").Where("id = ?", phone.ID).Row().Scan(&raw.Phone, &raw.Formatted)
+	if !regexp.MustCompile(`^\d{11}$`).MatchString(raw.Phone) || raw.Phone == phone.Phone {
+		t.Errorf("token should be 11 digits different from plaintext, got %v", raw.Phone)
+	}
+	if !regexp.MustCompile(`^\+\d{2} \d{3}-\d{4}-\d{4}$`).MatchString(raw.Formatted) {
+		t.Errorf("token should keep the format, got %v", raw.Formatted)
+	}
+
+	var got testPhone
+	if err := db.Where(&testPhone{Phone: "18601774393"}).First(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Phone != phone.Phone || got.Formatted != phone.Formatted {
+		t.Errorf("First() got = %+v", got)
+	}
+	if err := db.Create(&testPhone{Phone: "18601774393", Formatted: "186"}).Error; err == nil {
+		t.Errorf("Create() with a too short token value should fail")
+	}
+	if _, err := Backfill(db, &testPhone{}, BackfillOptions{Fields: []string{"phone"}}); err == nil {
+		t.Errorf("Backfill() should refuse token fields")
+	}
+}
+
+func TestBackfill_PlaintextTokens(t *testing.T) {
+	db := newTestDB(t, &testPhone{})
+	if err := db.Exec("INSERT INTO test_phones (id, phone, formatted) VALUES (?, ?, ?)", 1, "18601774393", "+86 186-0177-4393").Error; err != nil {
+		t.Fatal(err)
+	}
+	// 迁移前明文被当作令牌还原，读到的是另一个号码
+	var got testPhone
+	if db.First(&got, 1); got.Phone == "18601774393" {
+		t.Errorf("First() before backfill got = %+v", got)
+	}
+
+	result, err := Backfill(db, &testPhone{}, BackfillOptions{Fields: []string{"phone", "formatted"}, PlaintextTokens: true, Verify: true})
+	if err != nil || result.Updated != 1 {
+		t.Fatalf("Backfill() got = %+v, %v", result, err)
+	}
+	got = testPhone{}
+	if err := db.Where(&testPhone{Phone: "18601774393"}).First(&got).Error; err != nil || got.Formatted != "+86 186-0177-4393" {
+		t.Errorf("First() after backfill got = %+v, %v", got, err)
+	}
+}
+
+// warnLogger 记录 Warn 日志
+type warnLogger struct {
+	logger.Interface
+	warnings []string
+}
+
+func (l *warnLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(msg, data...))
+}
+
+type testSized struct {
+	ID       uint
+	Phone    string `gorm:"size:11" encryption:"true"`
+	Token    string `gorm:"size:11" encryption:"mode:token"`
+	Email    string `gorm:"size:128" encryption:"mode:deterministic;plain_size:64"`
+	Envelope string `gorm:"size:255" encryption:"mode:envelope;plain_size:64"`
+	Address  string `gorm:"size:255" encryption:"true;plain_size:256"`
+}
+
+func TestCheckColumnSize(t *testing.T) {
+	db := newTestDB(t)
+	log := &warnLogger{Interface: db.Logger}
+	db.Logger = log
+	if err := newEncryptor(defaultEncryptor.config).registerModels(db, &testSized{}); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(log.warnings, "\n")
+	for _, column := range []string{"test_sizeds.phone ", "test_sizeds.address "} {
+		if !strings.Contains(got, column) {
+			t.Errorf("missing warning for %s in %q", column, got)
+		}
+	}
+	if len(log.warnings) != 2 {
+		t.Errorf("warnings got = %q, want 2", log.warnings)
+	}
+}
@@ -5,10 +5,46 @@ import (
 	"github.com/zhang1github2test/gorm-learning/callback"
 	. "github.com/zhang1github2test/gorm-learning/database"
 	"github.com/zhang1github2test/gorm-learning/model"
+	"os"
 	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-backfill" {
+		if err := encryptBackfill(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-ids" {
+		if err := migrateIDs(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-audit" {
+		if err := migrateAudit(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-slowquery" {
+		if err := migrateSlowQuery(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	test_aes()
 }
 func test_aes() {
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/zhang1github2test/gorm-learning/audit"
+	. "github.com/zhang1github2test/gorm-learning/database"
+)
+
+// migrateAudit 创建或更新审计插件使用的 audit_logs 表，部署新版本前执行一次：
+//
+//	myapp migrate-audit
+func migrateAudit() error {
+	return audit.Migrate(GLOBALDB)
+}
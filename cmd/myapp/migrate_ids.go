@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	. "github.com/zhang1github2test/gorm-learning/database"
+	"github.com/zhang1github2test/gorm-learning/idgen"
+	"github.com/zhang1github2test/gorm-learning/model"
+)
+
+// migrateIDs 把 users、students 的 id 列从 int 改为 bigint，之后新增的记录使用 snowflake ID：
+//
+//	myapp migrate-ids
+//
+// 已经是 bigint 的列会被跳过，重复执行是安全的
+func migrateIDs() error {
+	altered, err := idgen.MigrateBigint(GLOBALDB, &model.User{}, &model.Student{})
+	for _, column := range altered {
+		fmt.Printf("altered %s to bigint\n", column)
+	}
+	return err
+}
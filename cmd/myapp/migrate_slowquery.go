@@ -0,0 +1,13 @@
+package main
+
+import (
+	. "github.com/zhang1github2test/gorm-learning/database"
+	"github.com/zhang1github2test/gorm-learning/slowquery"
+)
+
+// migrateSlowQuery 创建或更新慢查询插件使用的 slow_queries 表，部署新版本前执行一次：
+//
+//	myapp migrate-slowquery
+func migrateSlowQuery() error {
+	return slowquery.Migrate(GLOBALDB)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zhang1github2test/gorm-learning/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+// serve 启动 HTTP 服务，/metrics 输出 Prometheus 指标，--trace-stdout 时把 SQL 的 span 输出到标准输出，例如：
+//
+//	myapp serve --metrics-addr :9090 --trace-stdout
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("metrics-addr", ":9090", "listen address of the /metrics endpoint")
+	traceStdout := flags.Bool("trace-stdout", false, "export gorm spans to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *traceStdout {
+		provider, err := tracing.NewStdoutProvider(os.Stdout)
+		if err != nil {
+			return err
+		}
+		otel.SetTracerProvider(provider)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(*addr, mux)
+}
@@ -1,15 +1,18 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"github.com/zhang1github2test/gorm-learning/guard"
+	"github.com/zhang1github2test/gorm-learning/idgen"
+	"github.com/zhang1github2test/gorm-learning/logging"
+	"github.com/zhang1github2test/gorm-learning/metrics"
 	"github.com/zhang1github2test/gorm-learning/model"
 	"github.com/zhang1github2test/gorm-learning/plugin"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"gorm.io/plugin/dbresolver"
-	"log"
-	"os"
 	"time"
 )
 
@@ -20,19 +23,52 @@ func init() {
 	// 参考 https://github.com/go-sql-driver/mysql#dsn-data-source-name 获取详情
 	dsn := "root:my-secret-pw@tcp(192.168.188.101:3306)/test?charset=utf8mb4&parseTime=True&loc=Local"
 	dsn2 := "root:my-secret-pw@tcp(192.168.188.101:3307)/test?charset=utf8mb4&parseTime=True&loc=Local"
+	// 每个实例需要不同的 snowflake worker ID（0-1023），由环境变量 GORM_WORKER_ID 设置
+	workerID, err := idgen.WorkerIDFromEnv(idgen.WorkerIDEnv)
+	if err != nil {
+		panic(err)
+	}
 	GLOBALDB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		// 以 JSON 输出到标准输出，生产环境可以设置 InfoSampleEvery 对 Info 级别的 SQL 采样，
+		// 或者通过 PackageLevels 单独调整某个包的日志级别
+		Logger: logging.New(logging.Config{
 			SlowThreshold:             time.Second, // Slow SQL threshold
 			LogLevel:                  logger.Info, // Log level
 			IgnoreRecordNotFoundError: true,        // Ignore ErrRecordNotFound error for logger
-			ParameterizedQueries:      false,       // true: Don't include params in the SQL log
-			Colorful:                  false,       // Disable color
 		}),
 	})
+	// 新增时为 User、Student 的 ID 生成 snowflake ID，已有的 int 列先执行 myapp migrate-ids 改为 bigint
+	GLOBALDB.Use(&plugin.IDGen{WorkerID: workerID})
 	// 注册加解密的回调
 	//callback.Register(GLOBALDB)
-	GLOBALDB.Use(&plugin.Encrypt{})
-	GLOBALDB.Use(dbresolver.Register(dbresolver.Config{
+	// Student.Phone 为令牌模式，切换前写入的明文手机号需要执行一次
+	// myapp encrypt-backfill --model student --field phone --plaintext-tokens --verify
+	GLOBALDB.Use(plugin.NewEncrypt(plugin.Options{
+		FailOnDecryptError: true,
+		Models:             []interface{}{&model.Student{}},
+	}))
+	// SQL 日志中的手机号、邮箱等参数脱敏
+	GLOBALDB.Use(&plugin.Mask{})
+	// 新增、更新、删除写入 audit_logs 审计表，表由 myapp migrate-audit 创建
+	GLOBALDB.Use(&plugin.Audit{})
+	// 拦截不带条件的更新、删除等危险语句，先以告警模式观察，确认没有误报后改为 guard.ModeEnforce
+	GLOBALDB.Use(&plugin.Guard{
+		Mode:            guard.ModeWarn,
+		LargeTables:     []string{"users"},
+		MaxRowsAffected: 1000,
+	})
+	// 缓存 UserDao.First 等热点查询，修改后自动失效。Student 带有加密字段，不会被缓存
+	GLOBALDB.Use(&plugin.Cache{TTL: map[string]time.Duration{
+		"User": time.Minute,
+	}})
+	// 语句耗时、错误、影响行数以及连接池指标，由 cmd/myapp serve 的 /metrics 输出
+	GLOBALDB.Use(&plugin.Metrics{})
+	// 每个语句一个 span，使用全局的 TracerProvider，cmd/myapp serve --trace-stdout 输出到标准输出
+	GLOBALDB.Use(&plugin.Tracing{})
+	// 超过 1 秒的语句 EXPLAIN 后按指纹聚合写入 slow_queries 表（由 myapp migrate-slowquery 创建），
+	// 按 count、total_ms 排序查找缺少索引的语句
+	GLOBALDB.Use(&plugin.SlowQuery{Threshold: time.Second})
+	resolver := dbresolver.Register(dbresolver.Config{
 		Sources:  []gorm.Dialector{mysql.Open(dsn)},
 		Replicas: []gorm.Dialector{mysql.Open(dsn2)},
 		// sources/replicas load balancing policy
@@ -46,7 +82,12 @@ func init() {
 		Policy: dbresolver.RandomPolicy{},
 		// print sources/replicas mode in logger
 		TraceResolverMode: true,
-	}, &model.Student{}))
+	}, &model.Student{})
+	// 连接池名称按注册顺序对应 3306 写库、3307 读库、Student 使用的 3307，指标注册失败只记录日志，不影响服务启动
+	if err := metrics.WatchResolver(resolver, nil, "source", "replica", "student_source"); err != nil {
+		GLOBALDB.Logger.Error(context.Background(), "metrics: watch resolver pools failed: %v", err)
+	}
+	GLOBALDB.Use(resolver)
 	if err != nil {
 		panic(err)
 	}
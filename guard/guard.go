@@ -0,0 +1,267 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Mode 拦截到危险语句时的处理方式
+type Mode int
+
+const (
+	// ModeEnforce 拒绝执行，语句返回错误
+	ModeEnforce Mode = iota
+	// ModeWarn 只通过 db.Logger 输出告警，语句照常执行，适合上线初期观察误报
+	ModeWarn
+)
+
+var (
+	// ErrMissingWhere UPDATE/DELETE 没有 WHERE 条件，或者条件恒为真（例如 1 = 1）
+	ErrMissingWhere = errors.New("guard: update or delete without where conditions")
+	// ErrLeadingWildcard 大表上以 % 或 _ 开头的 LIKE 条件，无法使用索引
+	ErrLeadingWildcard = errors.New("guard: leading wildcard like on large table")
+	// ErrTooManyRows 单条语句影响的行数超过 Config.MaxRowsAffected
+	ErrTooManyRows = errors.New("guard: too many rows affected")
+)
+
+type bypassKey struct{}
+
+// Bypass 返回跳过检查的 context，用于确实需要全表更新、删除的数据修复等场景
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// Config 检查配置
+type Config struct {
+	// Mode 为零值时为 ModeEnforce
+	Mode Mode
+	// LargeTables 检查 LIKE 前导通配符的表，为空时不检查
+	LargeTables []string
+	// MaxRowsAffected 单条 UPDATE/DELETE 允许影响的最大行数，0 表示不限制
+	MaxRowsAffected int64
+}
+
+// guard 危险语句检查回调
+type guard struct {
+	config      Config
+	largeTables map[string]bool
+}
+
+// Register 注册危险语句检查：
+//   - UPDATE/DELETE 没有 WHERE 条件、也没有主键时拦截，包括 Raw/Exec 的 SQL；与 GORM 的检查不同，AllowGlobalUpdate 不能跳过，需要使用 Bypass
+//   - LargeTables 中的表使用以 % 或 _ 开头的 LIKE 条件时拦截
+//   - UPDATE/DELETE 影响的行数超过 MaxRowsAffected 时返回 ErrTooManyRows，默认事务中的修改会回滚；
+//     Exec 没有默认事务，只能在执行后报错，需要回滚时在调用方的事务中执行
+func Register(db *gorm.DB, config Config) error {
+	g := &guard{config: config, largeTables: make(map[string]bool, len(config.LargeTables))}
+	for _, table := range config.LargeTables {
+		g.largeTables[strings.ToLower(table)] = true
+	}
+	db.Callback().Query().Before("gorm:query").Register("customer:guard_query", g.check)
+	db.Callback().Row().Before("gorm:row").Register("customer:guard_row", g.check)
+	db.Callback().Raw().Before("gorm:raw").Register("customer:guard_raw", g.check)
+	db.Callback().Update().Before("gorm:begin_transaction").Register("customer:guard_update", g.checkWrite)
+	db.Callback().Delete().Before("gorm:begin_transaction").Register("customer:guard_delete", g.checkWrite)
+	if config.MaxRowsAffected > 0 {
+		db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("customer:guard_update_rows", g.checkRows)
+		db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("customer:guard_delete_rows", g.checkRows)
+		db.Callback().Raw().After("gorm:raw").Register("customer:guard_raw_rows", g.checkRows)
+	}
+	return nil
+}
+
+// report 按 Mode 拒绝语句或输出告警
+func (g *guard) report(db *gorm.DB, err error) {
+	if g.config.Mode == ModeWarn {
+		db.Logger.Warn(db.Statement.Context, "%v", err)
+		return
+	}
+	db.AddError(err)
+}
+
+func (g *guard) skip(db *gorm.DB) bool {
+	return db.Error != nil || bypassed(db.Statement.Context)
+}
+
+// check 检查查询和 Raw/Exec 的语句：已经有 SQL 时按 SQL 检查，否则按 WHERE 子句检查 LIKE
+func (g *guard) check(db *gorm.DB) {
+	if g.skip(db) {
+		return
+	}
+	if db.Statement.SQL.Len() > 0 {
+		g.checkSQL(db, db.Statement.SQL.String(), db.Statement.Vars)
+		return
+	}
+	g.checkLike(db)
+}
+
+// checkWrite 检查 Update/Delete 的条件
+func (g *guard) checkWrite(db *gorm.DB) {
+	if g.skip(db) {
+		return
+	}
+	if db.Statement.SQL.Len() > 0 {
+		g.checkSQL(db, db.Statement.SQL.String(), db.Statement.Vars)
+		return
+	}
+	if !hasWhere(db) && !hasPrimaryKey(db) {
+		g.report(db, fmt.Errorf("%w: %s", ErrMissingWhere, db.Statement.Table))
+		return
+	}
+	g.checkLike(db)
+}
+
+// checkRows 检查影响的行数
+func (g *guard) checkRows(db *gorm.DB) {
+	if g.skip(db) || db.RowsAffected <= g.config.MaxRowsAffected || !writeSQL.MatchString(db.Statement.SQL.String()) {
+		return
+	}
+	g.report(db, fmt.Errorf("%w: %d rows on %s, limit %d", ErrTooManyRows, db.RowsAffected, tableOf(db), g.config.MaxRowsAffected))
+}
+
+// checkLike 检查 WHERE 子句中的 LIKE 前导通配符
+func (g *guard) checkLike(db *gorm.DB) {
+	if !g.largeTables[strings.ToLower(db.Statement.Table)] {
+		return
+	}
+	if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok && leadingWildcard(where.Exprs) {
+		g.report(db, fmt.Errorf("%w: %s", ErrLeadingWildcard, db.Statement.Table))
+	}
+}
+
+var (
+	writeSQL     = regexp.MustCompile(`(?is)^\s*(update|delete)\b`)
+	whereSQL     = regexp.MustCompile(`(?is)\bwhere\b(.*)$`)
+	tautologySQL = regexp.MustCompile(`(?is)^\s*\(?\s*(1\s*=\s*1|true|1|'1'\s*=\s*'1')\s*\)?\s*(order\s+by\b.*|limit\b.*|returning\b.*)?;?\s*$`)
+	tableSQL     = regexp.MustCompile("(?i)\\b(?:from|update|into|join)\\s+[`\"]?(\\w+)")
+	likeSQL      = regexp.MustCompile(`(?i)\blike\s+(\?|'[%_])`)
+)
+
+// checkSQL 检查 Raw/Exec 的 SQL
+func (g *guard) checkSQL(db *gorm.DB, sql string, vars []interface{}) {
+	if writeSQL.MatchString(sql) {
+		where := whereSQL.FindStringSubmatch(sql)
+		if where == nil || tautologySQL.MatchString(where[1]) {
+			g.report(db, fmt.Errorf("%w: %s", ErrMissingWhere, sql))
+			return
+		}
+	}
+	for _, table := range tableSQL.FindAllStringSubmatch(sql, -1) {
+		if g.largeTables[strings.ToLower(table[1])] && likeWildcard(sql, vars) {
+			g.report(db, fmt.Errorf("%w: %s", ErrLeadingWildcard, sql))
+			return
+		}
+	}
+}
+
+// hasWhere 判断是否有 WHERE 条件，只有恒为真的条件（Where("1 = 1")）时视为没有条件
+func hasWhere(db *gorm.DB) bool {
+	where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return false
+	}
+	for _, expr := range where.Exprs {
+		if e, ok := expr.(clause.Expr); ok && len(e.Vars) == 0 && tautologySQL.MatchString(e.SQL) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// hasPrimaryKey 判断模型是否带有主键值，GORM 会据此生成主键条件。
+// Update 的 Dest 是 map 时 ReflectValue 还没有切换到模型，这里直接使用 Model
+func hasPrimaryKey(db *gorm.DB) bool {
+	if db.Statement.Schema == nil || db.Statement.Model == nil {
+		return false
+	}
+	rv := reflect.Indirect(reflect.ValueOf(db.Statement.Model))
+	if rv.Kind() != reflect.Struct {
+		return rv.Kind() == reflect.Slice && rv.Len() > 0
+	}
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingWildcard 递归检查条件中是否有以通配符开头的 LIKE
+func leadingWildcard(exprs []clause.Expression) bool {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Like:
+			if wildcard(e.Value) {
+				return true
+			}
+		case clause.Expr:
+			if likeWildcard(e.SQL, e.Vars) {
+				return true
+			}
+		case clause.NamedExpr:
+			if likeWildcard(e.SQL, e.Vars) {
+				return true
+			}
+		case clause.AndConditions:
+			if leadingWildcard(e.Exprs) {
+				return true
+			}
+		case clause.OrConditions:
+			if leadingWildcard(e.Exprs) {
+				return true
+			}
+		case clause.NotConditions:
+			if leadingWildcard(e.Exprs) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// likeWildcard 判断 SQL 中的 LIKE 是否使用了以通配符开头的字面量或参数
+func likeWildcard(sql string, vars []interface{}) bool {
+	matches := likeSQL.FindAllStringSubmatch(sql, -1)
+	if len(matches) == 0 {
+		return false
+	}
+	for _, match := range matches {
+		if match[1] != "?" {
+			return true
+		}
+	}
+	for _, v := range vars {
+		if wildcard(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func wildcard(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && (strings.HasPrefix(s, "%") || strings.HasPrefix(s, "_"))
+}
+
+func tableOf(db *gorm.DB) string {
+	if db.Statement.Table != "" {
+		return db.Statement.Table
+	}
+	if table := tableSQL.FindStringSubmatch(db.Statement.SQL.String()); table != nil {
+		return table[1]
+	}
+	return ""
+}
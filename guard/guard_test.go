@@ -0,0 +1,125 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:32"`
+}
+
+// warnLogger 记录 Warn 日志
+type warnLogger struct {
+	logger.Interface
+	warnings []string
+}
+
+func (l *warnLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(msg, data...))
+}
+
+func newTestDB(t *testing.T, config Config) (*gorm.DB, *warnLogger) {
+	t.Helper()
+	log := &warnLogger{Interface: logger.Discard}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]testUser{{Name: "zhang"}, {Name: "li"}, {Name: "wang"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, log
+}
+
+func TestGuard(t *testing.T) {
+	db, _ := newTestDB(t, Config{LargeTables: []string{"test_users"}, MaxRowsAffected: 2})
+	tests := []struct {
+		name    string
+		run     func(db *gorm.DB) *gorm.DB
+		wantErr error
+	}{
+		{name: "update without where", run: func(db *gorm.DB) *gorm.DB {
+			return db.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(&testUser{}).Update("name", "zhao")
+		}, wantErr: ErrMissingWhere},
+		{name: "delete with tautology", run: func(db *gorm.DB) *gorm.DB { return db.Where("1 = 1").Delete(&testUser{}) }, wantErr: ErrMissingWhere},
+		{name: "exec update without where", run: func(db *gorm.DB) *gorm.DB { return db.Exec("UPDATE test_users SET name = ?", "zhao") }, wantErr: ErrMissingWhere},
+		{name: "exec delete with tautology", run: func(db *gorm.DB) *gorm.DB { return db.Exec("delete from test_users where 1=1") }, wantErr: ErrMissingWhere},
+		{name: "leading wildcard", run: func(db *gorm.DB) *gorm.DB { return db.Where("name like ?", "%zhang%").Find(&[]testUser{}) }, wantErr: ErrLeadingWildcard},
+		{name: "leading wildcard in or", run: func(db *gorm.DB) *gorm.DB {
+			return db.Where("id = ?", 1).Or(clause.Like{Column: "name", Value: "_hang"}).Find(&[]testUser{})
+		}, wantErr: ErrLeadingWildcard},
+		{name: "delete leading wildcard", run: func(db *gorm.DB) *gorm.DB {
+			return db.Where("name like ?", "%zhangshenglu%").Delete(&testUser{})
+		}, wantErr: ErrLeadingWildcard},
+		{name: "raw leading wildcard", run: func(db *gorm.DB) *gorm.DB {
+			return db.Raw("SELECT * FROM test_users WHERE name LIKE '%zhang'").Scan(&[]testUser{})
+		}, wantErr: ErrLeadingWildcard},
+		{name: "too many rows", run: func(db *gorm.DB) *gorm.DB { return db.Model(&testUser{}).Where("id > ?", 0).Update("name", "zhao") }, wantErr: ErrTooManyRows},
+		{name: "prefix like", run: func(db *gorm.DB) *gorm.DB { return db.Where("name like ?", "zhang%").Find(&[]testUser{}) }},
+		{name: "update by primary key", run: func(db *gorm.DB) *gorm.DB { return db.Model(&testUser{ID: 1}).Update("name", "zhang") }},
+		{name: "exec with where", run: func(db *gorm.DB) *gorm.DB { return db.Exec("UPDATE test_users SET name = ? WHERE id = ?", "li", 2) }},
+		{name: "bypass", run: func(db *gorm.DB) *gorm.DB {
+			return db.WithContext(Bypass(context.Background())).Where("name like ?", "%a%").Find(&[]testUser{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(db).Error; !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 被拦截的修改没有执行，超过行数限制的修改已经回滚
+	var names []string
+	if err := db.Model(&testUser{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[zhang li wang]" {
+		t.Errorf("names got = %v", names)
+	}
+}
+
+func TestGuard_Warn(t *testing.T) {
+	db, log := newTestDB(t, Config{Mode: ModeWarn, LargeTables: []string{"test_users"}, MaxRowsAffected: 2})
+	tests := []struct {
+		name    string
+		run     func(db *gorm.DB) *gorm.DB
+		wantErr error
+		rows    int64
+	}{
+		{name: "leading wildcard", run: func(db *gorm.DB) *gorm.DB { return db.Where("name like ?", "%a%").Find(&[]testUser{}) }, wantErr: ErrLeadingWildcard, rows: 2},
+		{name: "exec without where", run: func(db *gorm.DB) *gorm.DB { return db.Exec("UPDATE test_users SET name = ?", "zhao") }, wantErr: ErrTooManyRows, rows: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log.warnings = nil
+			tx := tt.run(db)
+			if tx.Error != nil || tx.RowsAffected != tt.rows {
+				t.Errorf("err = %v, RowsAffected = %d, want %d", tx.Error, tx.RowsAffected, tt.rows)
+			}
+			if len(log.warnings) == 0 || !strings.HasPrefix(log.warnings[len(log.warnings)-1], tt.wantErr.Error()) {
+				t.Errorf("warnings got = %v, want %v", log.warnings, tt.wantErr)
+			}
+		})
+	}
+}
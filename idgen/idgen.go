@@ -0,0 +1,165 @@
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Tag 标记需要生成 ID 的字段，例如 `idgen:"snowflake"`
+const Tag = "idgen"
+
+// 生成器类型
+const (
+	// KindSnowflake 整数字段，也可以用于字符串字段（十进制）
+	KindSnowflake = "snowflake"
+	// KindULID 字符串字段
+	KindULID = "ulid"
+)
+
+// WorkerIDEnv database/db.go 读取 worker ID 的环境变量
+const WorkerIDEnv = "GORM_WORKER_ID"
+
+var (
+	ErrInvalidWorkerID = fmt.Errorf("idgen: worker id must be between 0 and %d", MaxWorkerID)
+	ErrUnknownKind     = errors.New("idgen: unknown generator")
+	ErrULIDOverflow    = errors.New("idgen: ulid random part overflow within the same millisecond")
+)
+
+// Config ID 生成配置
+type Config struct {
+	// WorkerID snowflake 的 worker ID，0-1023，写同一个库的每个实例需要各不相同
+	WorkerID int64
+	// Epoch snowflake 时间戳的起点，为空时为 DefaultEpoch，已经生成过 ID 后不能修改
+	Epoch time.Time
+}
+
+// generator ID 生成回调
+type generator struct {
+	snowflake *Snowflake
+	ulid      *ULID
+}
+
+// Register 注册 ID 生成回调：新增前为带有 idgen 标签且值为零值的字段生成 ID，已经设置了值的不修改。
+// 支持结构体、切片（包括 CreateInBatches 的每一批）以及 map 的新增。
+// 整数主键需要同时设置 autoIncrement:false，否则 GORM 会把它当作自增列
+func Register(db *gorm.DB, config Config) error {
+	if config.Epoch.IsZero() {
+		config.Epoch = DefaultEpoch
+	}
+	snowflake, err := NewSnowflake(config.WorkerID, config.Epoch)
+	if err != nil {
+		return err
+	}
+	g := &generator{snowflake: snowflake, ulid: NewULID()}
+	db.Callback().Create().Before("gorm:before_create").Register("customer:idgen_create", g.assign)
+	return nil
+}
+
+// WorkerIDFromEnv 从环境变量读取 worker ID，没有设置时为 0
+func WorkerIDFromEnv(key string) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	workerID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || workerID < 0 || workerID > MaxWorkerID {
+		return 0, fmt.Errorf("%w: %s=%q", ErrInvalidWorkerID, key, value)
+	}
+	return workerID, nil
+}
+
+// fieldsOf 返回带有 idgen 标签的字段
+func fieldsOf(sch *schema.Schema) []*schema.Field {
+	var fields []*schema.Field
+	for _, field := range sch.Fields {
+		if _, ok := field.Tag.Lookup(Tag); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (g *generator) assign(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	fields := fieldsOf(db.Statement.Schema)
+	if len(fields) == 0 {
+		return
+	}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		g.assignMap(db, fields, dest)
+	case []map[string]interface{}:
+		for _, m := range dest {
+			g.assignMap(db, fields, m)
+		}
+	default:
+		rv := reflect.Indirect(db.Statement.ReflectValue)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				g.assignValue(db, fields, reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			g.assignValue(db, fields, rv)
+		}
+	}
+}
+
+func (g *generator) assignValue(db *gorm.DB, fields []*schema.Field, rv reflect.Value) {
+	for _, field := range fields {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			continue
+		}
+		id, err := g.next(field)
+		if err == nil {
+			err = field.Set(db.Statement.Context, rv, id)
+		}
+		if err != nil {
+			db.AddError(fmt.Errorf("idgen: %s.%s: %w", db.Statement.Schema.Name, field.Name, err))
+			return
+		}
+	}
+}
+
+func (g *generator) assignMap(db *gorm.DB, fields []*schema.Field, m map[string]interface{}) {
+	for _, field := range fields {
+		if value, ok := m[field.Name]; ok && value != nil {
+			continue
+		}
+		if value, ok := m[field.DBName]; ok && value != nil {
+			continue
+		}
+		id, err := g.next(field)
+		if err != nil {
+			db.AddError(fmt.Errorf("idgen: %s.%s: %w", db.Statement.Schema.Name, field.Name, err))
+			return
+		}
+		m[field.Name] = id
+	}
+}
+
+// next 按字段的标签生成 ID，snowflake 用于字符串字段时转为十进制字符串
+func (g *generator) next(field *schema.Field) (interface{}, error) {
+	switch kind := strings.ToLower(field.Tag.Get(Tag)); kind {
+	case KindSnowflake:
+		id := g.snowflake.Next()
+		if field.FieldType.Kind() == reflect.String {
+			return strconv.FormatInt(id, 10), nil
+		}
+		return id, nil
+	case KindULID:
+		return g.ulid.Next()
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+}
@@ -0,0 +1,211 @@
+package idgen
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID      uint   `gorm:"type:bigint;primaryKey;autoIncrement:false" idgen:"snowflake"`
+	OrderNo string `gorm:"size:26" idgen:"ulid"`
+	Name    string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestRegister(t *testing.T) {
+	db := openDB(t)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{WorkerID: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		create func() error
+		names  []string
+	}{
+		{name: "struct", create: func() error { return db.Create(&testUser{Name: "zhang"}).Error }, names: []string{"zhang"}},
+		{name: "create in batches", create: func() error {
+			return db.CreateInBatches(&[]testUser{{Name: "b1"}, {Name: "b2"}, {Name: "b3"}}, 2).Error
+		}, names: []string{"b1", "b2", "b3"}},
+		{name: "pointer slice", create: func() error {
+			return db.Create([]*testUser{{Name: "p1"}, {Name: "p2"}}).Error
+		}, names: []string{"p1", "p2"}},
+		{name: "map", create: func() error {
+			return db.Model(&testUser{}).Create(map[string]interface{}{"Name": "m1"}).Error
+		}, names: []string{"m1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.create(); err != nil {
+				t.Fatal(err)
+			}
+			var users []testUser
+			db.Where("name IN ?", tt.names).Order("id").Find(&users)
+			if len(users) != len(tt.names) {
+				t.Fatalf("users got = %+v", users)
+			}
+			for i, user := range users {
+				if user.Name != tt.names[i] || user.ID == 0 || len(user.OrderNo) != ULIDLength {
+					t.Errorf("user got = %+v", user)
+				}
+			}
+		})
+	}
+
+	// 已经设置的 ID 不修改
+	db.Create(&testUser{ID: 100014, OrderNo: "manual", Name: "fixed"})
+	var fixed testUser
+	db.Where("name = ?", "fixed").First(&fixed)
+	if fixed.ID != 100014 || fixed.OrderNo != "manual" {
+		t.Errorf("fixed got = %+v", fixed)
+	}
+	var ids []uint
+	db.Model(&testUser{}).Order("id").Pluck("id", &ids)
+	if len(ids) != 8 {
+		t.Errorf("ids got = %v", ids)
+	}
+}
+
+func TestRegister_InvalidWorkerID(t *testing.T) {
+	if err := Register(openDB(t), Config{WorkerID: MaxWorkerID + 1}); !errors.Is(err, ErrInvalidWorkerID) {
+		t.Errorf("Register() err = %v, want ErrInvalidWorkerID", err)
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock []time.Time
+	}{
+		{name: "same millisecond", clock: []time.Time{DefaultEpoch.Add(time.Hour)}},
+		{name: "clock moved backwards", clock: []time.Time{DefaultEpoch.Add(time.Hour), DefaultEpoch.Add(time.Minute)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSnowflake(3, DefaultEpoch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := 0
+			s.now = func() time.Time {
+				calls++
+				if calls > maxSequence/2 {
+					return tt.clock[len(tt.clock)-1]
+				}
+				return tt.clock[0]
+			}
+			var last int64
+			for i := 0; i < 2*maxSequence; i++ {
+				id := s.Next()
+				if id <= last {
+					t.Fatalf("id %d is not greater than %d", id, last)
+				}
+				last = id
+			}
+			at, workerID, _ := s.Decompose(last)
+			if workerID != 3 || at.Before(tt.clock[0]) {
+				t.Errorf("Decompose() got = %v, %d", at, workerID)
+			}
+		})
+	}
+}
+
+func TestULID(t *testing.T) {
+	u := NewULID()
+	now := time.UnixMilli(1700000000000)
+	u.now = func() time.Time { return now }
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		if i == 500 {
+			now = now.Add(time.Millisecond)
+		}
+		id, err := u.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("ulids should be sorted by generation order")
+	}
+	if ids[0][:10] != "01HF7YAT00" {
+		t.Errorf("timestamp part got = %s", ids[0][:10])
+	}
+}
+
+func TestMigrateBigint(t *testing.T) {
+	type legacyUser struct {
+		ID   uint `gorm:"type:int;primaryKey"`
+		Name string
+	}
+	db := openDB(t)
+	if err := db.Table("test_users").AutoMigrate(&legacyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Table("test_users").Create(&legacyUser{ID: 1, Name: "zhang"})
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "int to bigint", want: []string{"test_users.id"}},
+		{name: "already bigint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			altered, err := MigrateBigint(db, &testUser{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(altered) != len(tt.want) || len(tt.want) > 0 && altered[0] != tt.want[0] {
+				t.Errorf("altered got = %v, want %v", altered, tt.want)
+			}
+		})
+	}
+	var user testUser
+	if err := db.First(&user, 1).Error; err != nil || user.Name != "zhang" {
+		t.Errorf("existing row got = %+v, %v", user, err)
+	}
+}
+
+func TestWorkerIDFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "12", want: 12},
+		{value: "1024", wantErr: true},
+		{value: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(WorkerIDEnv, tt.value)
+			got, err := WorkerIDFromEnv(WorkerIDEnv)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("WorkerIDFromEnv() got = %d, %v", got, err)
+			}
+		})
+	}
+}
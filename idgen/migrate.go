@@ -0,0 +1,40 @@
+package idgen
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MigrateBigint 把模型中 idgen:"snowflake" 的整数列改为模型定义的类型（例如 type:bigint），已经是 bigint 的列跳过，返回修改的列。
+// 已有的行不变，snowflake ID 远大于原来的自增 ID，不会与已有的 ID 冲突。
+// 执行前先把模型的标签从 type:int 改为 type:bigint，外键列需要另外修改
+func MigrateBigint(db *gorm.DB, models ...interface{}) ([]string, error) {
+	var altered []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return altered, err
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return altered, err
+		}
+		for _, field := range fieldsOf(stmt.Schema) {
+			if !strings.EqualFold(field.Tag.Get(Tag), KindSnowflake) || field.DBName == "" {
+				continue
+			}
+			for _, columnType := range columnTypes {
+				if columnType.Name() != field.DBName || strings.Contains(strings.ToLower(columnType.DatabaseTypeName()), "bigint") {
+					continue
+				}
+				if err := db.Migrator().AlterColumn(model, field.Name); err != nil {
+					return altered, fmt.Errorf("idgen: alter %s.%s: %w", stmt.Schema.Table, field.DBName, err)
+				}
+				altered = append(altered, stmt.Schema.Table+"."+field.DBName)
+			}
+		}
+	}
+	return altered, nil
+}
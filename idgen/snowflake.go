@@ -0,0 +1,59 @@
+package idgen
+
+import (
+	"sync"
+	"time"
+)
+
+// snowflake ID 的位数：41 位毫秒时间戳、10 位 worker ID、12 位序号，最高位为 0，ID 为正的 int64
+const (
+	workerBits   = 10
+	sequenceBits = 12
+	// MaxWorkerID worker ID 的最大值
+	MaxWorkerID = 1<<workerBits - 1
+	maxSequence = 1<<sequenceBits - 1
+)
+
+// DefaultEpoch snowflake 时间戳的起点，41 位毫秒可以使用约 69 年
+var DefaultEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake snowflake ID 生成器，同一个 worker ID 生成的 ID 递增。
+// 时钟回拨时继续使用上次的时间戳，同一毫秒的序号用完时借用下一毫秒，不会生成重复的 ID 也不会阻塞
+type Snowflake struct {
+	mu       sync.Mutex
+	epoch    int64
+	workerID int64
+	last     int64
+	sequence int64
+	now      func() time.Time
+}
+
+// NewSnowflake 创建 snowflake 生成器，同一个库的多个实例需要使用不同的 workerID
+func NewSnowflake(workerID int64, epoch time.Time) (*Snowflake, error) {
+	if workerID < 0 || workerID > MaxWorkerID {
+		return nil, ErrInvalidWorkerID
+	}
+	return &Snowflake{epoch: epoch.UnixMilli(), workerID: workerID, now: time.Now}, nil
+}
+
+// Next 生成下一个 ID
+func (s *Snowflake) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := s.now().UnixMilli() - s.epoch
+	switch {
+	case ms > s.last:
+		s.last, s.sequence = ms, 0
+	case s.sequence < maxSequence:
+		s.sequence++
+	default:
+		s.last, s.sequence = s.last+1, 0
+	}
+	return s.last<<(workerBits+sequenceBits) | s.workerID<<sequenceBits | s.sequence
+}
+
+// Decompose 返回 snowflake ID 的生成时间、worker ID 和序号，用于排查问题
+func (s *Snowflake) Decompose(id int64) (time.Time, int64, int64) {
+	ms := id>>(workerBits+sequenceBits) + s.epoch
+	return time.UnixMilli(ms), id >> sequenceBits & MaxWorkerID, id & maxSequence
+}
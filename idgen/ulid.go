@@ -0,0 +1,79 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+	"time"
+)
+
+// crockford ULID 使用的 Crockford Base32 字母表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDLength ULID 字符串的长度，存储 ULID 的列可以使用 char(26)
+const ULIDLength = 26
+
+// ULID ULID 生成器：48 位毫秒时间戳加 80 位随机数，按字符串排序即按生成时间排序。
+// 同一毫秒内随机部分在上一个的基础上加一，保证同一个生成器生成的 ULID 递增
+type ULID struct {
+	mu      sync.Mutex
+	last    [16]byte
+	lastMs  int64
+	entropy io.Reader
+	now     func() time.Time
+}
+
+// NewULID 创建使用 crypto/rand 的 ULID 生成器
+func NewULID() *ULID {
+	return &ULID{entropy: rand.Reader, now: time.Now}
+}
+
+// Next 生成下一个 ULID
+func (u *ULID) Next() (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ms := u.now().UnixMilli()
+	if ms <= u.lastMs {
+		if !increment(u.last[6:]) {
+			return "", ErrULIDOverflow
+		}
+		return encode(u.last), nil
+	}
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := io.ReadFull(u.entropy, id[6:]); err != nil {
+		return "", err
+	}
+	u.last, u.lastMs = id, ms
+	return encode(id), nil
+}
+
+// increment 把大端字节序的 b 加一，溢出时返回 false
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode 把 128 位按 Crockford Base32 编码为 26 个字符，第一个字符只有 3 位
+func encode(id [16]byte) string {
+	out := make([]byte, ULIDLength)
+	for i := range out {
+		// 第 i 个字符对应 130 位（高位补 2 个 0）中的 [5i, 5i+5)
+		var v byte
+		for bit := 5*i - 2; bit < 5*i+3; bit++ {
+			v <<= 1
+			if bit >= 0 && id[bit/8]>>(7-bit%8)&1 == 1 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out)
+}
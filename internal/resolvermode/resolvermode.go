@@ -0,0 +1,19 @@
+// Package resolvermode 读取 dbresolver 在 Statement.Context 中记录的读写库，供 tracing、logging 等包共用
+package resolvermode
+
+import (
+	"context"
+
+	"gorm.io/plugin/dbresolver"
+)
+
+// key dbresolver 记录读写库使用的 context key，dbresolver 没有导出这个常量，这里与其内部的 resolverModeKey 保持一致，
+// 升级 dbresolver 后由测试检查是否仍然有效
+const key = dbresolver.ResolverModeKey("dbresolver:resolver_mode_key")
+
+// FromContext 返回 dbresolver 为当前语句选择的连接：source 或 replica，
+// 需要开启 dbresolver.Config.TraceResolverMode，事务中的语句以及没有经过 dbresolver 的语句返回 false
+func FromContext(ctx context.Context) (dbresolver.ResolverMode, bool) {
+	mode, ok := ctx.Value(key).(dbresolver.ResolverMode)
+	return mode, ok
+}
@@ -0,0 +1,93 @@
+package resolvermode
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func openDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestFromContext 检查 key 与 dbresolver 内部的常量一致：dbresolver.Use、Write 选择的连接能够从语句的 Context 中读取
+func TestFromContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		trace  bool
+		run    func(db *gorm.DB) error
+		want   dbresolver.ResolverMode
+		wantOK bool
+	}{
+		{name: "replica", trace: true, run: func(db *gorm.DB) error {
+			return db.Find(&[]testUser{}).Error
+		}, want: dbresolver.ResolverModeReplica, wantOK: true},
+		{name: "write", trace: true, run: func(db *gorm.DB) error {
+			return db.Clauses(dbresolver.Write).Find(&[]testUser{}).Error
+		}, want: dbresolver.ResolverModeSource, wantOK: true},
+		{name: "use", trace: true, run: func(db *gorm.DB) error {
+			return db.Clauses(dbresolver.Use("users"), dbresolver.Write).Find(&[]testUser{}).Error
+		}, want: dbresolver.ResolverModeSource, wantOK: true},
+		{name: "create", trace: true, run: func(db *gorm.DB) error {
+			return db.Create(&testUser{Name: "zhang"}).Error
+		}, want: dbresolver.ResolverModeSource, wantOK: true},
+		{name: "notTraced", run: func(db *gorm.DB) error {
+			return db.Find(&[]testUser{}).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openDB(t, "file::memory:")
+			source, replica := filepath.Join(dir, "source.db"), filepath.Join(dir, "replica.db")
+			openDB(t, source)
+			openDB(t, replica)
+			config := dbresolver.Config{
+				Sources:           []gorm.Dialector{sqlite.Open(source)},
+				Replicas:          []gorm.Dialector{sqlite.Open(replica)},
+				TraceResolverMode: tt.trace,
+			}
+			if err := db.Use(dbresolver.Register(config).Register(config, "users")); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				got dbresolver.ResolverMode
+				ok  bool
+			)
+			record := func(db *gorm.DB) { got, ok = FromContext(db.Statement.Context) }
+			if err := db.Callback().Query().Before("gorm:query").Register("test:resolver_mode", record); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Callback().Create().Before("gorm:create").Register("test:resolver_mode", record); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.run(db); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("FromContext() got = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/internal/resolvermode"
+	"github.com/zhang1github2test/gorm-learning/reqctx"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Config slog 日志配置
+type Config struct {
+	// Handler 为空时为输出到标准输出的 slog.NewJSONHandler
+	Handler slog.Handler
+	// LogLevel 默认的日志级别
+	LogLevel logger.LogLevel
+	// PackageLevels 按调用方的包设置日志级别，key 为包路径前缀，例如 github.com/zhang1github2test/gorm-learning/repository，
+	// 匹配多个时使用最长的前缀
+	PackageLevels map[string]logger.LogLevel
+	// SlowThreshold 慢 SQL 阈值，超过时输出 Warn 日志，0 表示不检查
+	SlowThreshold time.Duration
+	// IgnoreRecordNotFoundError 不输出 ErrRecordNotFound 错误
+	IgnoreRecordNotFoundError bool
+	// InfoSampleEvery Info 级别的 SQL 每 N 条输出 1 条，用于生产环境降低日志量，0 和 1 表示全部输出。
+	// 慢 SQL 和错误不采样
+	InfoSampleEvery uint64
+}
+
+// Logger 基于 log/slog 的 GORM 日志，以 JSON 输出 SQL、耗时、行数、调用位置、context 中的 trace/request ID 以及 dbresolver 的读写库
+type Logger struct {
+	config  Config
+	slog    *slog.Logger
+	counter *uint64
+	// maxLevel LogLevel 与 PackageLevels 中最高的级别，超过该级别的日志不需要遍历调用栈就可以丢弃
+	maxLevel logger.LogLevel
+}
+
+// New 创建 slog 日志
+func New(config Config) *Logger {
+	handler := config.Handler
+	if handler == nil {
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return &Logger{config: config, slog: slog.New(handler), counter: new(uint64), maxLevel: maxLevelOf(config)}
+}
+
+// LogMode implements logger.Interface
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.config.LogLevel = level
+	newLogger.maxLevel = maxLevelOf(newLogger.config)
+	return &newLogger
+}
+
+// Info implements logger.Interface
+func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if caller, ok := l.enabled(logger.Info); ok {
+		l.output(ctx, slog.LevelInfo, caller, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Warn implements logger.Interface
+func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if caller, ok := l.enabled(logger.Warn); ok {
+		l.output(ctx, slog.LevelWarn, caller, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Error implements logger.Interface
+func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if caller, ok := l.enabled(logger.Error); ok {
+		l.output(ctx, slog.LevelError, caller, fmt.Sprintf(msg, data...))
+	}
+}
+
+// enabled 判断 level 的日志是否需要输出，需要时返回调用位置。
+// 所有级别都低于 level 时直接丢弃，不遍历调用栈；否则需要调用方的包来确定 PackageLevels 中的级别
+func (l *Logger) enabled(level logger.LogLevel) (string, bool) {
+	if l.maxLevel < level {
+		return "", false
+	}
+	caller, pkg := callerOf()
+	return caller, l.levelOf(pkg) >= level
+}
+
+func (l *Logger) output(ctx context.Context, slogLevel slog.Level, caller, msg string, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.String("caller", caller))
+	attrs = append(attrs, contextAttrs(ctx)...)
+	l.slog.LogAttrs(ctx, slogLevel, msg, attrs...)
+}
+
+// Trace implements logger.Interface。先检查级别和采样，需要输出时才调用 fc 生成 SQL
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	var (
+		level     logger.LogLevel
+		slogLevel slog.Level
+		msg       string
+		extra     []slog.Attr
+	)
+	switch {
+	case err != nil && !(l.config.IgnoreRecordNotFoundError && errors.Is(err, gorm.ErrRecordNotFound)):
+		level, slogLevel, msg, extra = logger.Error, slog.LevelError, "sql error", []slog.Attr{slog.String("error", err.Error())}
+	case l.config.SlowThreshold > 0 && elapsed > l.config.SlowThreshold:
+		level, slogLevel, msg, extra = logger.Warn, slog.LevelWarn, "slow sql", []slog.Attr{slog.Duration("threshold", l.config.SlowThreshold)}
+	default:
+		level, slogLevel, msg = logger.Info, slog.LevelInfo, "sql"
+	}
+	caller, ok := l.enabled(level)
+	if !ok {
+		return
+	}
+	if every := l.config.InfoSampleEvery; level == logger.Info && every > 1 && (atomic.AddUint64(l.counter, 1)-1)%every != 0 {
+		return
+	}
+	sql, rows := fc()
+	attrs := append([]slog.Attr{
+		slog.String("sql", sql),
+		slog.Float64("duration_ms", float64(elapsed.Nanoseconds())/1e6),
+		slog.Int64("rows", rows),
+	}, extra...)
+	l.output(ctx, slogLevel, caller, msg, attrs...)
+}
+
+// maxLevelOf 返回 LogLevel 与 PackageLevels 中最高的级别
+func maxLevelOf(config Config) logger.LogLevel {
+	level := config.LogLevel
+	for _, packageLevel := range config.PackageLevels {
+		if packageLevel > level {
+			level = packageLevel
+		}
+	}
+	return level
+}
+
+// levelOf 返回调用方包的日志级别
+func (l *Logger) levelOf(pkg string) logger.LogLevel {
+	level, matched := l.config.LogLevel, ""
+	for prefix, packageLevel := range l.config.PackageLevels {
+		if strings.HasPrefix(pkg, prefix) && len(prefix) > len(matched) {
+			level, matched = packageLevel, prefix
+		}
+	}
+	return level
+}
+
+// contextAttrs 返回 context 中的 trace ID、span ID、请求 ID 和 dbresolver 的读写库
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if ctx == nil {
+		return attrs
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	if requestID := reqctx.RequestIDFromContext(ctx); requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	if mode, ok := resolvermode.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("resolver", string(mode)))
+	}
+	return attrs
+}
+
+// callerOf 返回 GORM 和本文件之外第一个调用方的 文件:行号 以及包路径。
+// 包装日志（例如 mask.Logger）转发的 Trace 等方法是编译器生成的代码，同样跳过
+func callerOf() (string, string) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		pkg := packageOf(frame.Function)
+		if pkg != "" && !strings.HasPrefix(pkg, "gorm.io/") && frame.File != thisFile && frame.File != "<autogenerated>" {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line), pkg
+		}
+		if !more {
+			return "", ""
+		}
+	}
+}
+
+// thisFile 本文件的路径
+var thisFile = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return file
+}()
+
+// packageOf 从函数全名（例如 github.com/a/b/repository.(*UserDao).First）中取出包路径
+func packageOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
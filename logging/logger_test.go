@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zhang1github2test/gorm-learning/mask"
+	"github.com/zhang1github2test/gorm-learning/reqctx"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:32"`
+	Phone string `gorm:"size:11" mask:"phone"`
+}
+
+// testPackage 测试代码的包路径，测试中的调用方即为本包
+const testPackage = "github.com/zhang1github2test/gorm-learning/logging"
+
+func newJSONHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+// records 解析输出的 JSON 日志
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, record)
+	}
+	buf.Reset()
+	return result
+}
+
+func newTestDB(t *testing.T, config Config) (*gorm.DB, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	config.Handler = newJSONHandler(&buf)
+	db.Logger = mask.NewLogger(New(config))
+	if err := mask.Register(db); err != nil {
+		t.Fatal(err)
+	}
+	return db, &buf
+}
+
+func TestLogger_Trace(t *testing.T) {
+	db, buf := newTestDB(t, Config{LogLevel: logger.Info, IgnoreRecordNotFoundError: true})
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(reqctx.WithRequestID(context.Background(), "req-1"), "GET /users")
+	defer span.End()
+
+	db.WithContext(ctx).Create(&testUser{ID: 1, Name: "zhang", Phone: "18601774393"})
+	db.WithContext(ctx).First(&testUser{}, 2)
+	db.WithContext(ctx).Create(&testUser{ID: 1, Name: "zhang"})
+
+	got := records(t, buf)
+	tests := []struct {
+		name  string
+		level string
+		msg   string
+		sql   string
+	}{
+		{name: "create", level: "INFO", msg: "sql", sql: `INSERT INTO ` + "`test_users`" + ` (` + "`name`,`phone`,`id`" + `) VALUES ("zhang","186****4393",1)`},
+		{name: "record not found ignored", level: "INFO", msg: "sql", sql: "SELECT * FROM `test_users` WHERE `test_users`.`id` = 2"},
+		{name: "error", level: "ERROR", msg: "sql error", sql: "INSERT INTO `test_users`"},
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("records got %d, want %d: %v", len(got), len(tests), got)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := got[i]
+			if record["level"] != tt.level || record["msg"] != tt.msg || !strings.HasPrefix(record["sql"].(string), tt.sql) {
+				t.Errorf("record got = %v", record)
+			}
+			if record["trace_id"] != span.SpanContext().TraceID().String() || record["request_id"] != "req-1" {
+				t.Errorf("context attributes got = %v", record)
+			}
+			if caller, _ := record["caller"].(string); !strings.Contains(caller, "logger_test.go:") {
+				t.Errorf("caller got = %v", record["caller"])
+			}
+			if _, ok := record["duration_ms"].(float64); !ok {
+				t.Errorf("duration_ms got = %v", record["duration_ms"])
+			}
+		})
+	}
+}
+
+func TestLogger_Levels(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   int
+	}{
+		{name: "silent", config: Config{LogLevel: logger.Silent}, want: 0},
+		{name: "info", config: Config{LogLevel: logger.Info}, want: 4},
+		{name: "package level", config: Config{LogLevel: logger.Info, PackageLevels: map[string]logger.LogLevel{testPackage: logger.Warn}}, want: 1},
+		{name: "longest prefix", config: Config{LogLevel: logger.Silent, PackageLevels: map[string]logger.LogLevel{
+			"github.com/zhang1github2test": logger.Warn,
+			testPackage:                    logger.Info,
+		}}, want: 4},
+		{name: "sampling", config: Config{LogLevel: logger.Info, InfoSampleEvery: 2}, want: 3},
+		{name: "slow sql is not sampled", config: Config{LogLevel: logger.Info, InfoSampleEvery: 100, SlowThreshold: time.Nanosecond}, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.config.Handler = newJSONHandler(&buf)
+			l := New(tt.config)
+			for i := 0; i < 3; i++ {
+				l.Trace(context.Background(), time.Now().Add(-time.Millisecond), func() (string, int64) { return "SELECT 1", 1 }, nil)
+			}
+			l.Warn(context.Background(), "pool %s exhausted", "primary")
+			if got := records(t, &buf); len(got) != tt.want {
+				t.Errorf("records got %d, want %d: %v", len(got), tt.want, got)
+			}
+		})
+	}
+}
+
+// TestLogger_TraceLazy 不输出的 SQL（级别不够或被采样丢弃）不调用 fc，不生成 SQL
+func TestLogger_TraceLazy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		err    error
+		want   int
+	}{
+		{name: "warn", config: Config{LogLevel: logger.Warn}, want: 0},
+		{name: "silent error", config: Config{LogLevel: logger.Silent}, err: gorm.ErrInvalidData, want: 0},
+		{name: "package level", config: Config{LogLevel: logger.Info, PackageLevels: map[string]logger.LogLevel{testPackage: logger.Warn}}, want: 0},
+		{name: "sampling", config: Config{LogLevel: logger.Info, InfoSampleEvery: 3}, want: 1},
+		{name: "info", config: Config{LogLevel: logger.Info}, want: 3},
+		{name: "error", config: Config{LogLevel: logger.Error}, err: gorm.ErrInvalidData, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Handler = newJSONHandler(io.Discard)
+			l := New(tt.config)
+			var calls int
+			for i := 0; i < 3; i++ {
+				l.Trace(context.Background(), time.Now(), func() (string, int64) {
+					calls++
+					return "SELECT 1", 1
+				}, tt.err)
+			}
+			if calls != tt.want {
+				t.Errorf("fc calls got = %d, want %d", calls, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package mask
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// Marshal 将带 mask tag 的字段脱敏后序列化为 JSON，用于接口返回和日志，不修改 v 本身。
+// 支持 string、*string、sql.NullString 字段，以及嵌套的结构体、指针、切片和数组
+func Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return json.Marshal(v)
+	}
+	return json.Marshal(maskCopy(reflect.ValueOf(v)).Interface())
+}
+
+// maskCopy 返回脱敏后的副本，不包含脱敏字段的值原样返回
+func maskCopy(v reflect.Value) reflect.Value {
+	if !hasMask(v.Type()) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(maskCopy(v.Elem()))
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(maskCopy(v.Index(i)))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(maskCopy(v.Index(i)))
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if kind, ok := field.Tag.Lookup(Tag); ok {
+				maskField(copied.Field(i), kind)
+			} else {
+				copied.Field(i).Set(maskCopy(copied.Field(i)))
+			}
+		}
+		return copied
+	}
+	return v
+}
+
+var nullStringType = reflect.TypeOf(sql.NullString{})
+
+// maskField 脱敏单个字段，*string 字段替换为新的指针
+func maskField(field reflect.Value, kind string) {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(Value(kind, field.String()))
+	case field.Type() == nullStringType:
+		if s := field.Interface().(sql.NullString); s.Valid {
+			field.Set(reflect.ValueOf(sql.NullString{String: Value(kind, s.String), Valid: true}))
+		}
+	case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.String && !field.IsNil():
+		masked := reflect.New(field.Type().Elem())
+		masked.Elem().SetString(Value(kind, field.Elem().String()))
+		field.Set(masked)
+	}
+}
+
+// maskedTypes 类型中是否包含 mask tag 的缓存
+var maskedTypes sync.Map
+
+// hasMask 判断类型中（包括嵌套的结构体）是否有带 mask tag 的字段
+func hasMask(t reflect.Type) bool {
+	if has, ok := maskedTypes.Load(t); ok {
+		return has.(bool)
+	}
+	has := findMask(t, map[reflect.Type]bool{})
+	maskedTypes.Store(t, has)
+	return has
+}
+
+// findMask 递归查找 mask tag，visiting 避免递归类型无限循环
+func findMask(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return findMask(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, tagged := field.Tag.Lookup(Tag); tagged || findMask(field.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
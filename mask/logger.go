@@ -0,0 +1,238 @@
+package mask
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Logger 包装 GORM 日志，SQL 日志中属于 mask 字段的绑定参数替换为脱敏后的值。
+// 需要配合 Register 注册的回调使用：回调在语句执行前收集 mask 字段的值，Logger 按值替换参数
+type Logger struct {
+	logger.Interface
+}
+
+// NewLogger 包装已有的日志
+func NewLogger(l logger.Interface) *Logger {
+	return &Logger{Interface: l}
+}
+
+// LogMode implements logger.Interface
+func (l *Logger) LogMode(level logger.LogLevel) logger.Interface {
+	return &Logger{Interface: l.Interface.LogMode(level)}
+}
+
+// ParamsFilter implements gorm.ParamsFilter
+func (l *Logger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if filter, ok := l.Interface.(gorm.ParamsFilter); ok {
+		sql, params = filter.ParamsFilter(ctx, sql, params...)
+	}
+	values, _ := ctx.Value(maskedValuesKey{}).(maskedValues)
+	if len(values) == 0 || len(params) == 0 {
+		return sql, params
+	}
+	masked := make([]interface{}, len(params))
+	for i, param := range params {
+		masked[i] = param
+		if s, ok := stringOf(param); ok {
+			if m, ok := values[s]; ok {
+				masked[i] = m
+			}
+		}
+	}
+	return sql, masked
+}
+
+// maskedValues 语句中 mask 字段的值到脱敏值的映射
+type maskedValues map[string]string
+
+type maskedValuesKey struct{}
+
+// Register 注册收集 mask 字段值的回调，通常与 NewLogger 一起使用：
+//
+//	db.Logger = mask.NewLogger(db.Logger)
+//	mask.Register(db)
+func Register(db *gorm.DB) error {
+	db.Callback().Create().Before("gorm:create").Register("customer:mask_create", CollectValues)
+	db.Callback().Query().Before("gorm:query").Register("customer:mask_query", CollectValues)
+	db.Callback().Update().Before("gorm:update").Register("customer:mask_update", CollectValues)
+	db.Callback().Delete().Before("gorm:delete").Register("customer:mask_delete", CollectValues)
+	db.Callback().Row().Before("gorm:row").Register("customer:mask_row", CollectValues)
+	return nil
+}
+
+// CollectValues 收集语句中 mask 字段的值：写入的结构体/map，以及 WHERE 中针对 mask 列的条件参数，
+// 结果放在 Statement.Context 中供 Logger 使用
+func CollectValues(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	columns := maskedColumns(stmt.Schema)
+	if len(columns) == 0 {
+		return
+	}
+
+	values := maskedValues{}
+	collectReflectValue(stmt, columns, values, stmt.ReflectValue)
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		collectMap(stmt.Schema, columns, values, dest)
+	case []map[string]interface{}:
+		for _, m := range dest {
+			collectMap(stmt.Schema, columns, values, m)
+		}
+	default:
+		if dest != nil && dest != stmt.Model {
+			collectReflectValue(stmt, columns, values, reflect.Indirect(reflect.ValueOf(dest)))
+		}
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			collectExpressions(stmt.Schema, columns, values, where.Exprs)
+		}
+	}
+	if len(values) > 0 {
+		stmt.Context = context.WithValue(stmt.Context, maskedValuesKey{}, values)
+	}
+}
+
+// schemaColumns schema 中 mask 字段的缓存，key 为列名，value 为脱敏类型
+var schemaColumns sync.Map
+
+func maskedColumns(sch *schema.Schema) map[string]string {
+	if columns, ok := schemaColumns.Load(sch); ok {
+		return columns.(map[string]string)
+	}
+	columns := map[string]string{}
+	for _, field := range sch.Fields {
+		if kind, ok := field.Tag.Lookup(Tag); ok && field.DBName != "" {
+			columns[field.DBName] = kind
+		}
+	}
+	schemaColumns.Store(sch, columns)
+	return columns
+}
+
+func (values maskedValues) add(kind string, value interface{}) {
+	if s, ok := stringOf(value); ok && s != "" {
+		values[s] = Value(kind, s)
+	}
+}
+
+func collectReflectValue(stmt *gorm.Statement, columns map[string]string, values maskedValues, rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collectReflectValue(stmt, columns, values, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		if rv.Type() != stmt.Schema.ModelType {
+			return
+		}
+		for column, kind := range columns {
+			if field := stmt.Schema.LookUpField(column); field != nil {
+				value, _ := field.ValueOf(stmt.Context, rv)
+				values.add(kind, value)
+			}
+		}
+	}
+}
+
+// collectMap map 的键可以是列名或字段名
+func collectMap(sch *schema.Schema, columns map[string]string, values maskedValues, m map[string]interface{}) {
+	for key, value := range m {
+		if field := sch.LookUpField(key); field != nil {
+			if kind, ok := columns[field.DBName]; ok {
+				values.add(kind, value)
+			}
+		}
+	}
+}
+
+func collectExpressions(sch *schema.Schema, columns map[string]string, values maskedValues, exprs []clause.Expression) {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if kind, ok := columnKind(sch, columns, e.Column); ok {
+				values.add(kind, e.Value)
+			}
+		case clause.Neq:
+			if kind, ok := columnKind(sch, columns, e.Column); ok {
+				values.add(kind, e.Value)
+			}
+		case clause.Like:
+			if kind, ok := columnKind(sch, columns, e.Column); ok {
+				values.add(kind, e.Value)
+			}
+		case clause.IN:
+			if kind, ok := columnKind(sch, columns, e.Column); ok {
+				for _, v := range e.Values {
+					values.add(kind, v)
+				}
+			}
+		case clause.Expr:
+			collectExpr(columns, values, e)
+		case clause.AndConditions:
+			collectExpressions(sch, columns, values, e.Exprs)
+		case clause.OrConditions:
+			collectExpressions(sch, columns, values, e.Exprs)
+		case clause.NotConditions:
+			collectExpressions(sch, columns, values, e.Exprs)
+		}
+	}
+}
+
+func columnKind(sch *schema.Schema, columns map[string]string, column interface{}) (string, bool) {
+	var name string
+	switch c := column.(type) {
+	case string:
+		name = c
+	case clause.Column:
+		name = c.Name
+	}
+	if field := sch.LookUpField(name); field != nil {
+		kind, ok := columns[field.DBName]
+		return kind, ok
+	}
+	return "", false
+}
+
+// placeholderColumn 匹配占位符前的 “列名 操作符”，例如 phone = ?、`email` IN (?
+var placeholderColumn = regexp.MustCompile("(?i)[`\"]?(\\w+)[`\"]?\\s*(?:=|<>|!=|like|in)\\s*\\(?\\s*$")
+
+// collectExpr 处理 Where("phone = ?", phone) 这类字符串条件：按占位符前面的列名判断参数是否需要脱敏
+func collectExpr(columns map[string]string, values maskedValues, expr clause.Expr) {
+	sql := expr.SQL
+	for i := 0; i < len(expr.Vars); i++ {
+		idx := strings.IndexByte(sql, '?')
+		if idx < 0 {
+			return
+		}
+		if m := placeholderColumn.FindStringSubmatch(sql[:idx]); m != nil {
+			if kind, ok := columns[strings.ToLower(m[1])]; ok {
+				addVar(kind, values, expr.Vars[i])
+			}
+		}
+		sql = sql[idx+1:]
+	}
+}
+
+// addVar 参数可以是单个值或切片（IN ?）
+func addVar(kind string, values maskedValues, v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < rv.Len(); i++ {
+			values.add(kind, rv.Index(i).Interface())
+		}
+		return
+	}
+	values.add(kind, v)
+}
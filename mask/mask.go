@@ -0,0 +1,81 @@
+package mask
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tag 标记脱敏字段的 struct tag 名称，例如 mask:"phone"
+const Tag = "mask"
+
+// 支持的脱敏类型
+const (
+	// Phone 手机号：保留前 3 位和后 4 位，例如 138****1234
+	Phone = "phone"
+	// Email 邮箱：保留用户名首字符和域名，例如 z***@163.com
+	Email = "email"
+	// Name 姓名：只保留第一个字，例如 张**
+	Name = "name"
+	// IDCard 身份证号：保留前 6 位和后 4 位
+	IDCard = "idcard"
+)
+
+// Value 按脱敏类型处理字符串，未知的类型只保留首尾各一个字符
+func Value(kind, value string) string {
+	if value == "" {
+		return value
+	}
+	switch strings.ToLower(kind) {
+	case Phone:
+		return keep(value, 3, 4)
+	case Email:
+		at := strings.LastIndexByte(value, '@')
+		if at <= 0 {
+			return keep(value, 1, 1)
+		}
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + "***" + value[at:]
+	case Name:
+		return keep(value, 1, 0)
+	case IDCard:
+		return keep(value, 6, 4)
+	default:
+		return keep(value, 1, 1)
+	}
+}
+
+// keep 保留前 head 个和后 tail 个字符，其余替换为 *；字符数不多于 head+tail 时只保留第一个字符
+func keep(value string, head, tail int) string {
+	runes := []rune(value)
+	if len(runes) <= head+tail {
+		head, tail = 1, 0
+		if len(runes) == 1 {
+			head = 0
+		}
+	}
+	return string(runes[:head]) + strings.Repeat("*", len(runes)-head-tail) + string(runes[len(runes)-tail:])
+}
+
+// stringOf 取出字符串类型的值，支持 string、*string、[]byte、sql.NullString
+func stringOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case *string:
+		if v != nil {
+			return *v, true
+		}
+	case []byte:
+		if v != nil {
+			return string(v), true
+		}
+	case sql.NullString:
+		return v.String, v.Valid
+	case *sql.NullString:
+		if v != nil && v.Valid {
+			return v.String, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+package mask
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  string
+		value string
+		want  string
+	}{
+		{name: "phone", kind: Phone, value: "13812341234", want: "138****1234"},
+		{name: "shortPhone", kind: Phone, value: "12345", want: "1****"},
+		{name: "email", kind: Email, value: "zhang@163.com", want: "z***@163.com"},
+		{name: "invalidEmail", kind: Email, value: "zhang", want: "z***g"},
+		{name: "name", kind: Name, value: "张三丰", want: "张**"},
+		{name: "idcard", kind: IDCard, value: "310101199001011234", want: "310101********1234"},
+		{name: "single", kind: "other", value: "a", want: "*"},
+		{name: "empty", kind: Phone, value: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Value(tt.kind, tt.value); got != tt.want {
+				t.Errorf("Value() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testContact struct {
+	Phone string `json:"phone" mask:"phone"`
+}
+
+type testUser struct {
+	ID       uint          `gorm:"primaryKey" json:"id"`
+	Name     string        `json:"name"`
+	Phone    string        `json:"phone" mask:"phone"`
+	Email    *string       `json:"email" mask:"email"`
+	Contacts []testContact `gorm:"-" json:"contacts,omitempty"`
+}
+
+func TestMarshal(t *testing.T) {
+	email := "zhang@163.com"
+	user := &testUser{ID: 1, Name: "zhang", Phone: "13812341234", Email: &email, Contacts: []testContact{{Phone: "18601774393"}}}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "pointer", value: user, want: `{"id":1,"name":"zhang","phone":"138****1234","email":"z***@163.com","contacts":[{"phone":"186****4393"}]}`},
+		{name: "slice", value: []testContact{{Phone: "13812341234"}}, want: `[{"phone":"138****1234"}]`},
+		{name: "plain", value: map[string]int{"a": 1}, want: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.value)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Marshal() got = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+	if user.Phone != "13812341234" || *user.Email != "zhang@163.com" || user.Contacts[0].Phone != "18601774393" {
+		t.Errorf("Marshal() modified the value: %+v", user)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: NewLogger(logger.New(log.New(&buf, "", 0), logger.Config{LogLevel: logger.Info})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	email := "zhang@163.com"
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB) error
+		want string
+	}{
+		{name: "create", run: func(db *gorm.DB) error {
+			return db.Create(&testUser{ID: 1, Name: "zhang", Phone: "13812341234", Email: &email}).Error
+		}, want: "138****1234"},
+		{name: "struct", run: func(db *gorm.DB) error {
+			return db.Where(&testUser{Phone: "13812341234"}).Find(&[]testUser{}).Error
+		}, want: "138****1234"},
+		{name: "string", run: func(db *gorm.DB) error {
+			return db.Model(&testUser{}).Where("name = ? AND email IN ?", "zhang", []string{email}).Find(&[]testUser{}).Error
+		}, want: "z***@163.com"},
+		{name: "update", run: func(db *gorm.DB) error {
+			return db.Model(&testUser{ID: 1}).Update("phone", "13812341234").Error
+		}, want: "138****1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			if err := tt.run(db); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.String()
+			if strings.Contains(got, "13812341234") || strings.Contains(got, email) || !strings.Contains(got, tt.want) {
+				t.Errorf("log is not masked: %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// DefaultNamespace 指标名称的默认前缀
+const DefaultNamespace = "gorm"
+
+// PrimaryPool 主连接池在连接池指标 db_name 标签中的名称
+const PrimaryPool = "primary"
+
+// Config 指标配置
+type Config struct {
+	// Registerer 为空时为 prometheus.DefaultRegisterer，cmd/myapp 的 /metrics 使用默认的 Registerer
+	Registerer prometheus.Registerer
+	// Namespace 为空时为 DefaultNamespace
+	Namespace string
+	// Buckets 耗时直方图的桶，为空时为 prometheus.DefBuckets
+	Buckets []float64
+	// PoolName 连接池指标 db_name 标签的值，多个 *gorm.DB 使用同一个 Registerer 时需要各不相同，为空时为 PrimaryPool
+	PoolName string
+}
+
+// recorder 语句指标
+type recorder struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	rows     *prometheus.CounterVec
+}
+
+// startKey 语句中保存开始时间的 key
+const startKey = "metrics:start"
+
+// Register 注册语句指标回调和主连接池指标：
+//   - <namespace>_statement_duration_seconds{operation,table} 语句耗时
+//   - <namespace>_statement_errors_total{operation,table,code} 语句错误，code 为 MySQL 错误码，其他错误为 other，不包括 ErrRecordNotFound
+//   - <namespace>_rows_affected_total{operation,table} 影响（查询为返回）的行数
+//   - go_sql_*{db_name="primary"} 主连接池的打开、使用中、空闲连接数以及等待次数和时长，每次抓取时读取 sql.DBStats
+//
+// dbresolver 的连接池使用 WatchResolver 添加
+func Register(db *gorm.DB, config Config) error {
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Namespace == "" {
+		config.Namespace = DefaultNamespace
+	}
+	if config.Buckets == nil {
+		config.Buckets = prometheus.DefBuckets
+	}
+	if config.PoolName == "" {
+		config.PoolName = PrimaryPool
+	}
+	labels := []string{"operation", "table"}
+	r := &recorder{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Name:      "statement_duration_seconds",
+			Help:      "Duration of gorm statements by operation and table.",
+			Buckets:   config.Buckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "statement_errors_total",
+			Help:      "Failed gorm statements by operation, table and MySQL error code.",
+		}, append(labels, "code")),
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "rows_affected_total",
+			Help:      "Rows affected or returned by gorm statements.",
+		}, labels),
+	}
+	// 多个 *gorm.DB 使用同一个 Registerer 时共用已经注册的指标
+	duration, err := register(config.Registerer, r.duration)
+	if err != nil {
+		return err
+	}
+	errorCounter, err := register(config.Registerer, r.errors)
+	if err != nil {
+		return err
+	}
+	rows, err := register(config.Registerer, r.rows)
+	if err != nil {
+		return err
+	}
+	r.duration, r.errors, r.rows = duration.(*prometheus.HistogramVec), errorCounter.(*prometheus.CounterVec), rows.(*prometheus.CounterVec)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := registerPool(config.Registerer, sqlDB, config.PoolName); err != nil {
+		return err
+	}
+
+	db.Callback().Create().Before("*").Register("customer:metrics_create_start", start)
+	db.Callback().Create().After("*").Register("customer:metrics_create", r.observe("create"))
+	db.Callback().Query().Before("*").Register("customer:metrics_query_start", start)
+	db.Callback().Query().After("*").Register("customer:metrics_query", r.observe("query"))
+	db.Callback().Update().Before("*").Register("customer:metrics_update_start", start)
+	db.Callback().Update().After("*").Register("customer:metrics_update", r.observe("update"))
+	db.Callback().Delete().Before("*").Register("customer:metrics_delete_start", start)
+	db.Callback().Delete().After("*").Register("customer:metrics_delete", r.observe("delete"))
+	db.Callback().Row().Before("*").Register("customer:metrics_row_start", start)
+	db.Callback().Row().After("*").Register("customer:metrics_row", r.observe("row"))
+	db.Callback().Raw().Before("*").Register("customer:metrics_raw_start", start)
+	db.Callback().Raw().After("*").Register("customer:metrics_raw", r.observe("raw"))
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+// observe 记录语句的耗时、错误和行数
+func (r *recorder) observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		table := db.Statement.Table
+		r.duration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			r.errors.WithLabelValues(operation, table, errorCode(db.Error)).Inc()
+		}
+		if db.RowsAffected > 0 {
+			r.rows.WithLabelValues(operation, table).Add(float64(db.RowsAffected))
+		}
+	}
+}
+
+// errorCode 返回 MySQL 错误码，例如 1062（唯一键冲突）、1213（死锁），其他错误返回 other
+func errorCode(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+	return "other"
+}
+
+// WatchResolver 添加 dbresolver 连接池的指标，需要在 db.Use(resolver) 之前调用。
+// 连接池按 Register 的顺序、每个配置先 Sources 后 Replicas 依次使用 names 中的名称（没有配置 Replicas 时与 Sources 共用连接池），
+// names 不够时命名为 resolver-<序号>
+func WatchResolver(resolver *dbresolver.DBResolver, registerer prometheus.Registerer, names ...string) error {
+	if resolver.DB != nil {
+		return errors.New("metrics: WatchResolver must be called before db.Use(resolver)")
+	}
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	seen := map[*sql.DB]bool{}
+	return resolver.Call(func(connPool gorm.ConnPool) error {
+		sqlDB, ok := connPool.(*sql.DB)
+		if !ok || seen[sqlDB] {
+			return nil
+		}
+		seen[sqlDB] = true
+		name := fmt.Sprintf("resolver-%d", len(seen))
+		if len(seen) <= len(names) {
+			name = names[len(seen)-1]
+		}
+		return registerPool(registerer, sqlDB, name)
+	})
+}
+
+func registerPool(registerer prometheus.Registerer, sqlDB *sql.DB, name string) error {
+	return registerer.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// register 注册指标，已经注册过时返回已有的指标
+func register(registerer prometheus.Registerer, collector prometheus.Collector) (prometheus.Collector, error) {
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			return registered.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return collector, nil
+}
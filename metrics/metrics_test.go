@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func openDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestMetrics(t *testing.T) {
+	db := openDB(t, "file::memory:")
+	registry := prometheus.NewRegistry()
+	if err := Register(db, Config{Registerer: registry}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]testUser{{ID: 1, Name: "zhang"}, {ID: 2, Name: "li"}})
+	db.Create(&testUser{ID: 1, Name: "wang"})
+	db.Find(&[]testUser{})
+	db.First(&testUser{}, 3)
+	db.Model(&testUser{}).Where("id = ?", 1).Update("name", "zhao")
+
+	tests := []struct {
+		name   string
+		metric prometheus.Collector
+		want   float64
+	}{
+		{name: "create rows", metric: rowsCounter(t, registry).WithLabelValues("create", "test_users"), want: 2},
+		{name: "query rows", metric: rowsCounter(t, registry).WithLabelValues("query", "test_users"), want: 2},
+		{name: "update rows", metric: rowsCounter(t, registry).WithLabelValues("update", "test_users"), want: 1},
+		{name: "create errors", metric: errorsCounter(t, registry).WithLabelValues("create", "test_users", "other"), want: 1},
+		{name: "not found is not an error", metric: errorsCounter(t, registry).WithLabelValues("query", "test_users", "other"), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.metric); got != tt.want {
+				t.Errorf("got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := testutil.CollectAndCount(durationHistogram(t, registry)); got == 0 {
+		t.Error("duration histogram should be observed")
+	}
+
+	// 同一个 Registerer 可以注册多个 *gorm.DB
+	if err := Register(openDB(t, "file::memory:"), Config{Registerer: registry, PoolName: "audit"}); err != nil {
+		t.Errorf("Register() second db: %v", err)
+	}
+	if err := Register(openDB(t, "file::memory:"), Config{Registerer: registry}); !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		t.Errorf("Register() with the same pool name err = %v, want AlreadyRegisteredError", err)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, want: "1062"},
+		{name: "wrapped deadlock", err: fmt.Errorf("update: %w", &mysql.MySQLError{Number: 1213}), want: "1213"},
+		{name: "other", err: gorm.ErrMissingWhereClause, want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err); got != tt.want {
+				t.Errorf("errorCode() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchResolver(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, "file::memory:")
+	registry := prometheus.NewRegistry()
+	if err := Register(db, Config{Registerer: registry}); err != nil {
+		t.Fatal(err)
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Sources:  []gorm.Dialector{sqlite.Open(filepath.Join(dir, "source.db"))},
+		Replicas: []gorm.Dialector{sqlite.Open(filepath.Join(dir, "replica.db"))},
+	}).Register(dbresolver.Config{
+		Sources: []gorm.Dialector{sqlite.Open(filepath.Join(dir, "student.db"))},
+	}, "students")
+	if err := WatchResolver(resolver, registry, "source", "replica"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(resolver); err != nil {
+		t.Fatal(err)
+	}
+	if err := WatchResolver(resolver, registry); err == nil {
+		t.Error("WatchResolver() after db.Use should fail")
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pools []string
+	for _, family := range families {
+		if family.GetName() != "go_sql_open_connections" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "db_name" {
+					pools = append(pools, label.GetValue())
+				}
+			}
+		}
+	}
+	sort.Strings(pools)
+	if fmt.Sprint(pools) != "[primary replica resolver-3 source]" {
+		t.Errorf("pools got = %v", pools)
+	}
+}
+
+func rowsCounter(t *testing.T, registry *prometheus.Registry) *prometheus.CounterVec {
+	return existing(t, registry, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: DefaultNamespace, Name: "rows_affected_total", Help: "Rows affected or returned by gorm statements.",
+	}, []string{"operation", "table"})).(*prometheus.CounterVec)
+}
+
+func errorsCounter(t *testing.T, registry *prometheus.Registry) *prometheus.CounterVec {
+	return existing(t, registry, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: DefaultNamespace, Name: "statement_errors_total", Help: "Failed gorm statements by operation, table and MySQL error code.",
+	}, []string{"operation", "table", "code"})).(*prometheus.CounterVec)
+}
+
+func durationHistogram(t *testing.T, registry *prometheus.Registry) *prometheus.HistogramVec {
+	return existing(t, registry, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: DefaultNamespace, Name: "statement_duration_seconds", Help: "Duration of gorm statements by operation and table.", Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "table"})).(*prometheus.HistogramVec)
+}
+
+// existing 返回 registry 中已经注册的同名指标
+func existing(t *testing.T, registry *prometheus.Registry, collector prometheus.Collector) prometheus.Collector {
+	t.Helper()
+	c, err := register(registry, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -4,13 +4,16 @@ import (
 	"time"
 )
 
+// Student 学生。
+// Phone 使用令牌模式加密，令牌与明文一样是 11 位数字，切换前写入的明文手机号会被当作令牌还原成另一个号码，
+// 升级后需要先执行一次 myapp encrypt-backfill --model student --field phone --plaintext-tokens --verify 迁移已有数据
 type Student struct {
-	ID           uint       `gorm:"type:int;comment:主键" json:"id"`     // Standard field for the primary key
-	Name         string     `gorm:"size:128;comment:学生姓名" json:"name"` // 一个常规字符串字段
+	ID           uint       `gorm:"type:bigint;autoIncrement:false;comment:主键" json:"id" idgen:"snowflake"` // Standard field for the primary key
+	Name         string     `gorm:"size:128;comment:学生姓名" json:"name"`                                      // 一个常规字符串字段
 	GuardianName string     `gorm:"size:128;comment:监护人姓名" json:"guardian_name"`
-	Age          uint8      `json:"age"`                                                  // 一个未签名的8位整数
-	Phone        string     `gorm:"size:11;comment:手机号码" json:"phone"  encryption:"true"` // 手机号码
-	Birthday     *time.Time `json:"birthday"`                                             // A pointer to time.Time, can be null
-	CreatedAt    *time.Time `json:"created_at"`                                           // 创建时间（由GORM自动管理）
-	UpdatedAt    *time.Time `json:"updated_at"`                                           // 最后一次更新时间（由GORM自动管理）
+	Age          uint8      `json:"age"`                                                                     // 一个未签名的8位整数
+	Phone        string     `gorm:"size:11;comment:手机号码" json:"phone"  encryption:"mode:token" mask:"phone"` // 手机号码，令牌模式加密后仍为 11 位数字
+	Birthday     *time.Time `json:"birthday"`                                                                // A pointer to time.Time, can be null
+	CreatedAt    *time.Time `json:"created_at"`                                                              // 创建时间（由GORM自动管理）
+	UpdatedAt    *time.Time `json:"updated_at"`                                                              // 最后一次更新时间（由GORM自动管理）
 }
@@ -1,22 +1,22 @@
 package model
 
 import (
-	"encoding/json"
 	"fmt"
+	"github.com/zhang1github2test/gorm-learning/mask"
 	"gorm.io/gorm"
 	"log"
 	"time"
 )
 
 type User struct {
-	ID        uint       `gorm:"type:int;comment:主键" json:"id"`      // Standard field for the primary key
-	Name      string     `gorm:"size:128;comment:人员姓名" json:"name"`  // 一个常规字符串字段
-	Email     *string    `gorm:"size:128;comment:邮箱地址" json:"email"` // 一个指向字符串的指针, allowing for null values
-	Age       uint8      `json:"age"`                                // 一个未签名的8位整数
-	Phone     string     `gorm:"size:11;comment:手机号码" json:"phone"`  // 手机号码
-	Birthday  *time.Time `json:"birthday"`                           // A pointer to time.Time, can be null
-	CreatedAt *time.Time `json:"created_at"`                         // 创建时间（由GORM自动管理）
-	UpdatedAt *time.Time `json:"updated_at"`                         // 最后一次更新时间（由GORM自动管理）
+	ID        uint       `gorm:"type:bigint;autoIncrement:false;comment:主键" json:"id" idgen:"snowflake"` // Standard field for the primary key
+	Name      string     `gorm:"size:128;comment:人员姓名" json:"name"`                                      // 一个常规字符串字段
+	Email     *string    `gorm:"size:128;comment:邮箱地址" json:"email" mask:"email"`                        // 一个指向字符串的指针, allowing for null values
+	Age       uint8      `json:"age"`                                                                    // 一个未签名的8位整数
+	Phone     string     `gorm:"size:11;comment:手机号码" json:"phone" mask:"phone"`                         // 手机号码
+	Birthday  *time.Time `json:"birthday"`                                                               // A pointer to time.Time, can be null
+	CreatedAt *time.Time `json:"created_at"`                                                             // 创建时间（由GORM自动管理）
+	UpdatedAt *time.Time `json:"updated_at"`                                                             // 最后一次更新时间（由GORM自动管理）
 }
 
 func (u *User) BeforeUpdate(tx *gorm.DB) (err error) {
@@ -43,8 +43,8 @@ func (u *User) AfterSave(tx *gorm.DB) error {
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	log.Println("BeforeCreate ...")
-	// 将结构体转为 JSON 格式
-	userJSON, err := json.Marshal(u)
+	// 将结构体转为 JSON 格式，手机号、邮箱脱敏后输出
+	userJSON, err := mask.Marshal(u)
 	if err != nil {
 		fmt.Println("Error marshalling to JSON:", err)
 		return err
@@ -0,0 +1,209 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNoPrincipal 访问受保护的模型时 context 中没有主体
+	ErrNoPrincipal = errors.New("permission: missing principal in context")
+	// ErrPermissionDenied 主体的角色没有模型的策略，或者没有管理员角色却使用了 Bypass
+	ErrPermissionDenied = errors.New("permission: permission denied")
+	// ErrMissingParam 条件模板的参数在主体中不存在
+	ErrMissingParam = errors.New("permission: missing condition parameter")
+)
+
+// Principal 当前访问数据的主体
+type Principal struct {
+	UserID string
+	Roles  []string
+	// Attributes 条件模板中 :user_id 以外的参数，例如 class_ids
+	Attributes map[string]interface{}
+}
+
+type principalKey struct{}
+
+type bypassKey struct{}
+
+// WithPrincipal 在 context 中设置当前主体，通过 db.WithContext(ctx) 传给语句
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext 返回 WithPrincipal 设置的主体
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Bypass 返回跳过数据权限的 context，只有拥有 Config.AdminRoles 中角色的主体可以使用，
+// 每条跳过的语句都会通过 Config.OnBypass 记录，reason 为跳过的原因（工单号等）
+func Bypass(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, bypassKey{}, reason)
+}
+
+// BypassEvent 一次跳过数据权限的访问
+type BypassEvent struct {
+	UserID    string
+	Roles     []string
+	Reason    string
+	Table     string
+	Operation string
+}
+
+// Config 数据权限配置
+type Config struct {
+	Policies []Policy
+	// AdminRoles 可以使用 Bypass 的角色
+	AdminRoles []string
+	// OnBypass 记录跳过数据权限的访问，为空时通过 db.Logger.Warn 输出
+	OnBypass func(ctx context.Context, event BypassEvent)
+}
+
+// enforcer 数据权限回调
+type enforcer struct {
+	config Config
+	// policies 模型 → 角色 → 条件，条件为 nil 表示可以访问全部数据
+	policies map[string]map[string][]*condition
+	admins   map[string]bool
+}
+
+// Register 注册数据权限回调：查询、更新、删除策略中的模型时，按 context 中主体的角色加上策略的条件，多个角色的条件使用 OR 连接。
+// 策略中没有出现的模型不受限制；模型受保护而主体的角色都没有对应的策略时返回 ErrPermissionDenied。
+// 条件只加在主表上，Raw、Exec 的语句不做处理
+func Register(db *gorm.DB, config Config) error {
+	e := &enforcer{config: config, policies: map[string]map[string][]*condition{}, admins: map[string]bool{}}
+	for _, policy := range config.Policies {
+		if policy.Role == "" || policy.Model == "" {
+			return fmt.Errorf("permission: policy requires role and model: %+v", policy)
+		}
+		roles, ok := e.policies[policy.Model]
+		if !ok {
+			roles = map[string][]*condition{}
+			e.policies[policy.Model] = roles
+		}
+		var cond *condition
+		if policy.Condition != "" {
+			parsed := parseCondition(policy.Condition)
+			cond = &parsed
+		}
+		roles[policy.Role] = append(roles[policy.Role], cond)
+	}
+	for _, role := range config.AdminRoles {
+		e.admins[role] = true
+	}
+	db.Callback().Query().Before("gorm:query").Register("customer:permission_query", e.scope("query"))
+	db.Callback().Row().Before("gorm:row").Register("customer:permission_row", e.scope("query"))
+	db.Callback().Update().Before("gorm:update").Register("customer:permission_update", e.scope("update"))
+	db.Callback().Delete().Before("gorm:delete").Register("customer:permission_delete", e.scope("delete"))
+	return nil
+}
+
+// rolesOf 返回模型的策略，策略可以按结构体名称或表名配置
+func (e *enforcer) rolesOf(db *gorm.DB) []map[string][]*condition {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	var result []map[string][]*condition
+	for _, model := range []string{db.Statement.Schema.Name, db.Statement.Schema.Table} {
+		if roles, ok := e.policies[model]; ok {
+			result = append(result, roles)
+		}
+	}
+	return result
+}
+
+// scope 按主体加上数据权限条件
+func (e *enforcer) scope(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		roles := e.rolesOf(db)
+		if roles == nil {
+			return
+		}
+		ctx := db.Statement.Context
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok {
+			db.AddError(fmt.Errorf("%w: %s", ErrNoPrincipal, db.Statement.Table))
+			return
+		}
+		if reason, ok := ctx.Value(bypassKey{}).(string); ok {
+			e.bypass(db, principal, reason, operation)
+			return
+		}
+
+		// 加上权限条件后 GORM 不再拦截不带条件的更新、删除，先按 gorm:update、gorm:delete 的规则检查
+		if operation != "query" {
+			if _, hasWhere := db.Statement.Clauses["WHERE"]; !hasWhere && !db.AllowGlobalUpdate && !hasPrimaryKey(db) {
+				db.AddError(gorm.ErrMissingWhereClause)
+				return
+			}
+		}
+
+		var exprs []clause.Expression
+		for _, role := range principal.Roles {
+			for _, policies := range roles {
+				for _, cond := range policies[role] {
+					if cond == nil {
+						return
+					}
+					vars, err := cond.vars(principal)
+					if err != nil {
+						db.AddError(err)
+						return
+					}
+					exprs = append(exprs, clause.Expr{SQL: cond.sql, Vars: vars})
+				}
+			}
+		}
+		switch len(exprs) {
+		case 0:
+			db.AddError(fmt.Errorf("%w: %s", ErrPermissionDenied, db.Statement.Table))
+		case 1:
+			db.Statement.AddClause(clause.Where{Exprs: exprs})
+		default:
+			// 只有一个条件的 OrConditions 会与前面的条件以 OR 连接，多个条件时才会整体加括号
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Or(exprs...)}})
+		}
+	}
+}
+
+// bypass 检查主体是否可以跳过数据权限，并记录本次访问
+func (e *enforcer) bypass(db *gorm.DB, principal Principal, reason, operation string) {
+	admin := false
+	for _, role := range principal.Roles {
+		admin = admin || e.admins[role]
+	}
+	if !admin {
+		db.AddError(fmt.Errorf("%w: bypass requires an admin role", ErrPermissionDenied))
+		return
+	}
+	event := BypassEvent{UserID: principal.UserID, Roles: principal.Roles, Reason: reason, Table: db.Statement.Table, Operation: operation}
+	if e.config.OnBypass != nil {
+		e.config.OnBypass(db.Statement.Context, event)
+		return
+	}
+	db.Logger.Warn(db.Statement.Context, "permission bypass: user %s %s %s, reason: %s", event.UserID, event.Operation, event.Table, event.Reason)
+}
+
+// hasPrimaryKey 判断更新、删除的模型中是否带有主键值，GORM 执行时会以主键作为条件
+func hasPrimaryKey(db *gorm.DB) bool {
+	rv := db.Statement.ReflectValue
+	if rv.Kind() != reflect.Struct {
+		return rv.Kind() == reflect.Slice && rv.Len() > 0
+	}
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testStudent struct {
+	ID         uint `gorm:"primaryKey"`
+	Name       string
+	GuardianID string
+	ClassID    int
+}
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+const testPolicies = `{"policies":[
+	{"role":"teacher","model":"testStudent","condition":"guardian_id = :user_id"},
+	{"role":"head","model":"test_students","condition":"class_id IN :class_ids"},
+	{"role":"user","model":"testUser","condition":"id = :user_id"},
+	{"role":"principal","model":"testStudent"}
+]}`
+
+func newTestDB(t *testing.T, onBypass func(ctx context.Context, event BypassEvent)) *gorm.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(testPolicies), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := LoadPolicies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testStudent{}, &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]testStudent{
+		{Name: "zhang", GuardianID: "1", ClassID: 1},
+		{Name: "li", GuardianID: "1", ClassID: 2},
+		{Name: "wang", GuardianID: "2", ClassID: 3},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]testUser{{Name: "zhang"}, {Name: "li"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{Policies: policies, AdminRoles: []string{"admin"}, OnBypass: onBypass}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPermission(t *testing.T) {
+	var events []BypassEvent
+	db := newTestDB(t, func(ctx context.Context, event BypassEvent) {
+		events = append(events, event)
+	})
+	as := func(principal Principal) *gorm.DB {
+		return db.WithContext(WithPrincipal(context.Background(), principal))
+	}
+	teacher := Principal{UserID: "1", Roles: []string{"teacher"}}
+	tests := []struct {
+		name    string
+		run     func() *gorm.DB
+		wantErr error
+		rows    int64
+	}{
+		{name: "teacher", run: func() *gorm.DB { return as(teacher).Find(&[]testStudent{}) }, rows: 2},
+		{name: "teacher with where", run: func() *gorm.DB { return as(teacher).Where("name = ? OR name = ?", "li", "wang").Find(&[]testStudent{}) }, rows: 1},
+		{name: "teacher and head", run: func() *gorm.DB {
+			return as(Principal{UserID: "1", Roles: []string{"teacher", "head"}, Attributes: map[string]interface{}{"class_ids": []int{3}}}).Find(&[]testStudent{})
+		}, rows: 3},
+		{name: "principal", run: func() *gorm.DB {
+			return as(Principal{UserID: "9", Roles: []string{"principal"}}).Find(&[]testStudent{})
+		}, rows: 3},
+		{name: "user", run: func() *gorm.DB { return as(Principal{UserID: "2", Roles: []string{"user"}}).Find(&[]testUser{}) }, rows: 1},
+		{name: "update", run: func() *gorm.DB {
+			return as(teacher).Model(&testStudent{}).Where("class_id > ?", 0).Update("name", "zhao")
+		}, rows: 2},
+		{name: "delete", run: func() *gorm.DB { return as(teacher).Delete(&testStudent{}, 3) }, rows: 0},
+		{name: "update without where", run: func() *gorm.DB { return as(teacher).Model(&testStudent{}).Update("name", "zhou") }, wantErr: gorm.ErrMissingWhereClause},
+		{name: "delete without where", run: func() *gorm.DB { return as(teacher).Delete(&testStudent{}) }, wantErr: gorm.ErrMissingWhereClause},
+		{name: "no principal", run: func() *gorm.DB { return db.Find(&[]testStudent{}) }, wantErr: ErrNoPrincipal},
+		{name: "no policy", run: func() *gorm.DB { return as(Principal{UserID: "1", Roles: []string{"user"}}).Find(&[]testStudent{}) }, wantErr: ErrPermissionDenied},
+		{name: "missing param", run: func() *gorm.DB { return as(Principal{UserID: "1", Roles: []string{"head"}}).Find(&[]testStudent{}) }, wantErr: ErrMissingParam},
+		{name: "bypass without admin", run: func() *gorm.DB {
+			return db.WithContext(Bypass(WithPrincipal(context.Background(), teacher), "T-1")).Find(&[]testStudent{})
+		}, wantErr: ErrPermissionDenied},
+		{name: "bypass", run: func() *gorm.DB {
+			return db.WithContext(Bypass(WithPrincipal(context.Background(), Principal{UserID: "0", Roles: []string{"admin"}}), "T-2")).Find(&[]testStudent{})
+		}, rows: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.run()
+			if !errors.Is(tx.Error, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", tx.Error, tt.wantErr)
+			}
+			if tt.wantErr == nil && tx.RowsAffected != tt.rows {
+				t.Errorf("RowsAffected = %d, want %d", tx.RowsAffected, tt.rows)
+			}
+		})
+	}
+
+	if len(events) != 1 || events[0].UserID != "0" || events[0].Reason != "T-2" || events[0].Table != "test_students" || events[0].Operation != "query" {
+		t.Errorf("bypass events got = %+v", events)
+	}
+	var wang testStudent
+	if err := db.WithContext(WithPrincipal(context.Background(), Principal{Roles: []string{"principal"}})).First(&wang, 3).Error; err != nil || wang.Name != "wang" {
+		t.Errorf("other guardian's student should not be changed, got = %+v, err = %v", wang, err)
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		sql      string
+		params   []string
+	}{
+		{name: "user", template: "guardian_id = :user_id", sql: "(guardian_id = ?)", params: []string{"user_id"}},
+		{name: "multiple", template: "school_id = :school_id AND (class_id IN :class_ids OR teacher_id=:user_id)", sql: "(school_id = ? AND (class_id IN ? OR teacher_id=?))", params: []string{"school_id", "class_ids", "user_id"}},
+		{name: "cast", template: "created_at::date = current_date", sql: "(created_at::date = current_date)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseCondition(tt.template)
+			if got.sql != tt.sql || len(got.params) != len(tt.params) {
+				t.Fatalf("parseCondition() got = %+v, want %s %v", got, tt.sql, tt.params)
+			}
+			for i := range got.params {
+				if got.params[i] != tt.params[i] {
+					t.Errorf("params[%d] got = %s, want %s", i, got.params[i], tt.params[i])
+				}
+			}
+		})
+	}
+}
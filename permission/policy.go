@@ -0,0 +1,77 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Policy 一个角色对一个模型的数据权限
+type Policy struct {
+	Role string `json:"role"`
+	// Model 模型的结构体名称（例如 Student）或表名（例如 students）
+	Model string `json:"model"`
+	// Condition 条件模板，例如 guardian_id = :user_id。:user_id 为 Principal.UserID，其他 :name 从 Principal.Attributes 中取值，
+	// 值为切片时可以用于 IN，例如 class_id IN :class_ids。为空时表示该角色可以访问模型的全部数据
+	Condition string `json:"condition"`
+}
+
+// policyFile 策略文件格式
+type policyFile struct {
+	Policies []Policy `json:"policies"`
+}
+
+// LoadPolicies 从 JSON 文件加载策略，文件格式：
+//
+//	{"policies":[{"role":"teacher","model":"Student","condition":"guardian_id = :user_id"},{"role":"admin","model":"Student"}]}
+func LoadPolicies(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pf policyFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("parse policy file %s: %w", path, err)
+	}
+	return pf.Policies, nil
+}
+
+// paramPattern 条件模板中的命名参数，:: 类型转换不是参数
+var paramPattern = regexp.MustCompile(`(^|[^:\w]):([A-Za-z_]\w*)`)
+
+// condition 解析后的条件模板，SQL 中的参数替换为 ?，params 为按顺序的参数名
+type condition struct {
+	sql    string
+	params []string
+}
+
+func parseCondition(template string) condition {
+	var cond condition
+	cond.sql = paramPattern.ReplaceAllStringFunc(template, func(match string) string {
+		sub := paramPattern.FindStringSubmatch(match)
+		cond.params = append(cond.params, sub[2])
+		return sub[1] + "?"
+	})
+	// 多个条件之间使用 OR 连接，模板自身带括号避免与 OR 混合时优先级错误
+	cond.sql = "(" + strings.TrimSpace(cond.sql) + ")"
+	return cond
+}
+
+// vars 按主体填充条件参数
+func (c condition) vars(principal Principal) ([]interface{}, error) {
+	vars := make([]interface{}, len(c.params))
+	for i, name := range c.params {
+		if name == "user_id" {
+			vars[i] = principal.UserID
+			continue
+		}
+		value, ok := principal.Attributes[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingParam, name)
+		}
+		vars[i] = value
+	}
+	return vars, nil
+}
@@ -0,0 +1,22 @@
+package plugin
+
+import (
+	"github.com/zhang1github2test/gorm-learning/audit"
+	"gorm.io/gorm"
+)
+
+// Audit 审计插件：新增、更新、删除后把操作类型、表、主键、变化的列（加密字段隐藏值）以及
+// context 中的操作者（callback.WithActor）和请求 ID（reqctx.WithRequestID）在同一个事务中写入 audit_logs 表。
+// 初始化时不建表，audit_logs 通过 audit.Migrate（myapp migrate-audit）创建
+type Audit struct {
+	// RedactTags 需要隐藏值的字段的 struct tag，为空时为加解密插件的 tag（默认 encryption）和 hash
+	RedactTags []string
+}
+
+func (a *Audit) Name() string {
+	return "my_customize:audit_plugin"
+}
+
+func (a *Audit) Initialize(db *gorm.DB) error {
+	return audit.Register(db, audit.Config{RedactTags: a.RedactTags})
+}
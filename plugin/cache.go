@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/cache"
+	"gorm.io/gorm"
+)
+
+// Cache 二级查询缓存插件：缓存 TTL 中模型的查询结果，新增、更新、删除后自动失效，
+// 单个查询可以通过 db.WithContext(cache.Skip(ctx)) 不使用缓存
+type Cache struct {
+	// Store 缓存存储，为空时使用进程内的 cache.NewLRU，多实例部署时使用 Redis 等实现 cache.Store
+	Store cache.Store
+	// TTL 每个模型的缓存时间，key 为模型的结构体名称或表名
+	TTL map[string]time.Duration
+	// Prefix 缓存 key 的前缀，为空时为 cache.DefaultPrefix
+	Prefix string
+}
+
+func (c *Cache) Name() string {
+	return "my_customize:cache_plugin"
+}
+
+func (c *Cache) Initialize(db *gorm.DB) error {
+	return cache.Register(db, cache.Config{Store: c.Store, TTL: c.TTL, Prefix: c.Prefix})
+}
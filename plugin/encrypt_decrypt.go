@@ -1,17 +1,72 @@
 package plugin
 
 import (
+	"context"
+
 	"github.com/zhang1github2test/gorm-learning/callback"
 	"gorm.io/gorm"
 )
 
+// Options 加解密插件的配置，字段含义见 callback.Config
+type Options struct {
+	// KeyProvider 主密钥提供者，为空时使用 callback.DefaultKeyProvider
+	KeyProvider callback.KeyProvider
+	// Algorithm encryption:"true" 字段使用的加密模式，为空时为 callback.ModeRandom
+	Algorithm string
+	// TagName 标记加密字段的 struct tag 名称，为空时为 encryption
+	TagName string
+	// FailOnDecryptError 未通过 on_error 指定策略的字段解密失败时查询是否返回错误，见 callback.OnErrorStrict
+	FailOnDecryptError bool
+	// OnDecryptError 字段按 lenient、null 策略忽略解密失败时调用
+	OnDecryptError func(ctx context.Context, err *callback.DecryptError)
+	// AuditSink 接收加密字段的读取记录，为空时不审计，例如 callback.NewTableAuditSink(db, 100, time.Second)，表由 callback.MigrateAuditSink 创建
+	AuditSink callback.AuditSink
+	// DecryptLegacy 读取时解密没有信封前缀的旧格式密文，callback.MigrateLegacy 迁移完成后关闭
+	DecryptLegacy bool
+	// SubjectKeys mode:subject 字段每个主体的数据密钥，例如 callback.NewSubjectKeyStore(keyDB)，表由 callback.MigrateSubjectKeys 创建
+	SubjectKeys *callback.SubjectKeyStore
+	// Models 需要预先注册的加密模型，通过 Raw().Scan() 扫描的加密模型必须在这里注册
+	Models []interface{}
+}
+
 type Encrypt struct {
+	// Models 需要预先注册的加密模型，通过 Raw().Scan() 扫描的加密模型必须在这里注册
+	Models []interface{}
+
+	// config 通过 NewEncrypt 创建时的配置，为空时使用 callback.Register 的默认配置
+	config *callback.Config
+}
+
+// NewEncrypt 按配置创建加解密插件，每个 *gorm.DB 初始化时创建各自的 callback.Encryptor，
+// 不同的数据库可以使用不同的主密钥和配置，例如：
+//
+//	db.Use(plugin.NewEncrypt(plugin.Options{KeyProvider: kms, Algorithm: callback.ModeEnvelope, Models: []interface{}{&model.Student{}}}))
+func NewEncrypt(opts Options) *Encrypt {
+	return &Encrypt{
+		Models: opts.Models,
+		config: &callback.Config{
+			KeyProvider:        opts.KeyProvider,
+			Algorithm:          opts.Algorithm,
+			TagName:            opts.TagName,
+			FailOnDecryptError: opts.FailOnDecryptError,
+			OnDecryptError:     opts.OnDecryptError,
+			AuditSink:          opts.AuditSink,
+			DecryptLegacy:      opts.DecryptLegacy,
+			SubjectKeys:        opts.SubjectKeys,
+		},
+	}
 }
 
 func (encrypt *Encrypt) Name() string {
 	return "my_customize:encrypt_plugin"
 }
 func (encrypt *Encrypt) Initialize(db *gorm.DB) error {
-	callback.Register(db)
-	return nil
+	if encrypt.config == nil {
+		return callback.Register(db, encrypt.Models...)
+	}
+	e, err := callback.New(*encrypt.config)
+	if err != nil {
+		return err
+	}
+	return e.Register(db, encrypt.Models...)
 }
@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"github.com/zhang1github2test/gorm-learning/guard"
+	"gorm.io/gorm"
+)
+
+// Guard SQL 安全检查插件：拦截没有 WHERE 条件的 UPDATE/DELETE（包括 Raw/Exec）、大表上以通配符开头的 LIKE，
+// 以及影响行数超过上限的修改。Mode 为 guard.ModeWarn 时只输出告警不拦截
+type Guard struct {
+	Mode guard.Mode
+	// LargeTables 检查 LIKE 前导通配符的表
+	LargeTables []string
+	// MaxRowsAffected 单条 UPDATE/DELETE 允许影响的最大行数，0 表示不限制
+	MaxRowsAffected int64
+}
+
+func (g *Guard) Name() string {
+	return "my_customize:guard_plugin"
+}
+
+func (g *Guard) Initialize(db *gorm.DB) error {
+	return guard.Register(db, guard.Config{Mode: g.Mode, LargeTables: g.LargeTables, MaxRowsAffected: g.MaxRowsAffected})
+}
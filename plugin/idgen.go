@@ -0,0 +1,25 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/idgen"
+	"gorm.io/gorm"
+)
+
+// IDGen ID 生成插件：新增时为 idgen:"snowflake"（整数）或 idgen:"ulid"（字符串）标签的零值字段生成 ID，
+// 支持 Create、CreateInBatches 和 map 新增，已经设置了值的字段不修改
+type IDGen struct {
+	// WorkerID snowflake 的 worker ID，0-1023，写同一个库的每个实例需要各不相同
+	WorkerID int64
+	// Epoch snowflake 时间戳的起点，为空时为 idgen.DefaultEpoch
+	Epoch time.Time
+}
+
+func (g *IDGen) Name() string {
+	return "my_customize:idgen_plugin"
+}
+
+func (g *IDGen) Initialize(db *gorm.DB) error {
+	return idgen.Register(db, idgen.Config{WorkerID: g.WorkerID, Epoch: g.Epoch})
+}
@@ -0,0 +1,19 @@
+package plugin
+
+import (
+	"github.com/zhang1github2test/gorm-learning/mask"
+	"gorm.io/gorm"
+)
+
+// Mask SQL 日志脱敏插件：包装 db.Logger，日志中 mask:"phone"、mask:"email" 等字段的参数输出为脱敏后的值
+type Mask struct {
+}
+
+func (m *Mask) Name() string {
+	return "my_customize:mask_plugin"
+}
+
+func (m *Mask) Initialize(db *gorm.DB) error {
+	db.Logger = mask.NewLogger(db.Logger)
+	return mask.Register(db)
+}
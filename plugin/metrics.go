@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zhang1github2test/gorm-learning/metrics"
+	"gorm.io/gorm"
+)
+
+// Metrics Prometheus 指标插件：按操作和表记录语句耗时、错误（按 MySQL 错误码）、影响行数以及连接池状态，
+// dbresolver 的连接池需要在 db.Use(resolver) 之前调用 metrics.WatchResolver
+type Metrics struct {
+	// Registerer 为空时为 prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	// Namespace 指标名称前缀，为空时为 metrics.DefaultNamespace
+	Namespace string
+	// Buckets 耗时直方图的桶，为空时为 prometheus.DefBuckets
+	Buckets []float64
+	// PoolName 连接池指标的 db_name，为空时为 metrics.PrimaryPool
+	PoolName string
+}
+
+func (m *Metrics) Name() string {
+	return "my_customize:metrics_plugin"
+}
+
+func (m *Metrics) Initialize(db *gorm.DB) error {
+	return metrics.Register(db, metrics.Config{Registerer: m.Registerer, Namespace: m.Namespace, Buckets: m.Buckets, PoolName: m.PoolName})
+}
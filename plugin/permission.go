@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/zhang1github2test/gorm-learning/permission"
+	"gorm.io/gorm"
+)
+
+// DataPermission 行级数据权限插件：按 context 中的主体（permission.WithPrincipal）给查询、更新、删除加上角色策略的条件，
+// 例如老师只能看到自己的学生：
+//
+//	db.Use(&plugin.DataPermission{PolicyFile: "policies.json", AdminRoles: []string{"admin"}})
+type DataPermission struct {
+	// PolicyFile 策略文件，格式见 permission.LoadPolicies
+	PolicyFile string
+	// Policies 直接配置的策略，与 PolicyFile 中的策略合并
+	Policies []permission.Policy
+	// AdminRoles 可以通过 permission.Bypass 跳过数据权限的角色
+	AdminRoles []string
+	// OnBypass 记录跳过数据权限的访问，为空时输出到 db.Logger
+	OnBypass func(ctx context.Context, event permission.BypassEvent)
+}
+
+func (p *DataPermission) Name() string {
+	return "my_customize:data_permission_plugin"
+}
+
+func (p *DataPermission) Initialize(db *gorm.DB) error {
+	policies := append([]permission.Policy(nil), p.Policies...)
+	if p.PolicyFile != "" {
+		loaded, err := permission.LoadPolicies(p.PolicyFile)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, loaded...)
+	}
+	return permission.Register(db, permission.Config{Policies: policies, AdminRoles: p.AdminRoles, OnBypass: p.OnBypass})
+}
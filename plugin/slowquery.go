@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"io"
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/slowquery"
+	"gorm.io/gorm"
+)
+
+// SlowQuery 慢查询插件：耗时超过 Threshold 的语句在同一个连接池上 EXPLAIN，按 SQL 指纹聚合次数、总耗时、最大耗时和最近的执行计划，
+// 写入 slow_queries 表，设置 Output 时改为以 JSON 行写入 Output。初始化时不建表，slow_queries 通过 slowquery.Migrate（myapp migrate-slowquery）创建
+type SlowQuery struct {
+	// Threshold 慢查询阈值，为 0 时为 1 秒
+	Threshold time.Duration
+	// Analyze 对 SELECT 使用 EXPLAIN ANALYZE，会再实际执行一次查询
+	Analyze bool
+	Output  io.Writer
+}
+
+func (s *SlowQuery) Name() string {
+	return "my_customize:slow_query_plugin"
+}
+
+func (s *SlowQuery) Initialize(db *gorm.DB) error {
+	config := slowquery.Config{Threshold: s.Threshold, Analyze: s.Analyze}
+	if s.Output != nil {
+		config.Recorder = slowquery.NewFileRecorder(s.Output)
+	}
+	return slowquery.Register(db, config)
+}
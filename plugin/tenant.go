@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"github.com/zhang1github2test/gorm-learning/tenant"
+	"gorm.io/gorm"
+)
+
+// Tenant 多租户隔离插件：从 context 中读取租户（tenant.WithTenant），带 tenant_id 列的模型自动按租户过滤和写入，
+// 没有租户的语句返回 tenant.ErrMissingTenant，需要访问全部租户时使用 tenant.Bypass。
+// 每个租户一个库时配置 Resolver，并在 dbresolver 中以返回的名称注册租户的库，例如：
+//
+//	db.Use(dbresolver.Register(dbresolver.Config{Sources: []gorm.Dialector{mysql.Open(dsnSchoolA)}}, "school_a"))
+//	db.Use(&plugin.Tenant{Resolver: func(tenantID string) string { return tenantID }})
+type Tenant struct {
+	// Column 租户列名，为空时为 tenant_id
+	Column string
+	// Resolver 返回租户使用的 dbresolver 名称，为空时不路由
+	Resolver func(tenantID string) string
+}
+
+func (t *Tenant) Name() string {
+	return "my_customize:tenant_plugin"
+}
+
+func (t *Tenant) Initialize(db *gorm.DB) error {
+	return tenant.Register(db, tenant.Config{Column: t.Column, Resolver: t.Resolver})
+}
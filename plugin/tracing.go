@@ -0,0 +1,22 @@
+package plugin
+
+import (
+	"github.com/zhang1github2test/gorm-learning/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Tracing OpenTelemetry 链路追踪插件：每个新增、查询、更新、删除、Row、Raw 语句创建一个 span，
+// 以 db.WithContext(ctx) 中的 span 为父 span，记录表、操作、参数化的 SQL、影响行数和 dbresolver 的读写库
+type Tracing struct {
+	// TracerProvider 为空时使用 otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+}
+
+func (t *Tracing) Name() string {
+	return "my_customize:tracing_plugin"
+}
+
+func (t *Tracing) Initialize(db *gorm.DB) error {
+	return tracing.Register(db, tracing.Config{TracerProvider: t.TracerProvider})
+}
@@ -0,0 +1,17 @@
+// Package reqctx 在 context 中保存请求级别的信息，供审计、日志等插件读取，不依赖任何插件
+package reqctx
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID 在 context 中设置请求 ID，通过 db.WithContext(ctx) 传给语句，审计记录和 SQL 日志中会带上该 ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 返回 WithRequestID 设置的请求 ID，没有设置时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,25 @@
+package reqctx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "empty", ctx: context.Background(), want: ""},
+		{name: "set", ctx: WithRequestID(context.Background(), "req-1"), want: "req-1"},
+		{name: "override", ctx: WithRequestID(WithRequestID(context.Background(), "req-1"), "req-2"), want: "req-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestIDFromContext(tt.ctx); got != tt.want {
+				t.Errorf("RequestIDFromContext() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package slowquery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// SlowQuery slow_queries 表的记录，每个指纹一行，按 Count、TotalMs 排序即可找到最需要加索引的语句
+type SlowQuery struct {
+	ID          uint   `gorm:"primaryKey"`
+	Fingerprint string `gorm:"size:40;uniqueIndex"`
+	Statement   string `gorm:"type:text"`
+	// Plan 最近一次的执行计划
+	Plan       string `gorm:"type:text"`
+	Count      int64
+	TotalMs    float64
+	MaxMs      float64
+	CreatedAt  time.Time
+	LastSeenAt time.Time `gorm:"index"`
+}
+
+// TableName 慢查询表名
+func (SlowQuery) TableName() string {
+	return "slow_queries"
+}
+
+// TableRecorder 按指纹聚合写入 slow_queries 表：新指纹插入一行，已有的累加次数和耗时，更新最大耗时和执行计划
+type TableRecorder struct {
+	db *gorm.DB
+}
+
+// Migrate 创建或更新 slow_queries 表，部署时执行一次（myapp migrate-slowquery），NewTableRecorder 和 Register 不会建表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&SlowQuery{})
+}
+
+// NewTableRecorder 写入 slow_queries 表，表需要先通过 Migrate 创建。db 为写入慢查询表使用的连接，可以与业务库不同；
+// 写入不在被记录语句的事务中，事务回滚时慢查询记录保留
+func NewTableRecorder(db *gorm.DB) (*TableRecorder, error) {
+	return &TableRecorder{db: db.Session(&gorm.Session{NewDB: true, Context: context.Background()})}, nil
+}
+
+// Record implements Recorder。直接在 db 的连接上执行 INSERT ... ON CONFLICT，不经过 Create 的回调链，
+// 慢查询记录不会被审计、拦截、追踪，也不会再被当作慢查询记录
+func (r *TableRecorder) Record(ctx context.Context, query Query) error {
+	ms := float64(query.Duration.Nanoseconds()) / 1e6
+	record := SlowQuery{
+		Fingerprint: query.Fingerprint,
+		Statement:   query.Statement,
+		Plan:        query.Plan,
+		Count:       1,
+		TotalMs:     ms,
+		MaxMs:       ms,
+		CreatedAt:   query.At,
+		LastSeenAt:  query.At,
+	}
+	stmt := &gorm.Statement{
+		DB:       r.db,
+		ConnPool: r.db.Statement.ConnPool,
+		Context:  r.db.Statement.Context,
+		Clauses:  map[string]clause.Clause{},
+		Dest:     &record,
+	}
+	if err := stmt.Parse(&record); err != nil {
+		return err
+	}
+	stmt.ReflectValue = reflect.ValueOf(&record).Elem()
+	stmt.AddClause(clause.OnConflict{
+		Columns: []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":        gorm.Expr("? + 1", clause.Column{Name: "count"}),
+			"total_ms":     gorm.Expr("? + ?", clause.Column{Name: "total_ms"}, ms),
+			"max_ms":       gorm.Expr("CASE WHEN ? < ? THEN ? ELSE ? END", clause.Column{Name: "max_ms"}, ms, ms, clause.Column{Name: "max_ms"}),
+			"plan":         query.Plan,
+			"last_seen_at": query.At,
+		}),
+	})
+	stmt.AddClause(clause.Insert{})
+	stmt.AddClause(callbacks.ConvertToCreateValues(stmt))
+	stmt.Build("INSERT", "VALUES", "ON CONFLICT")
+
+	begin := time.Now()
+	result, err := stmt.ConnPool.ExecContext(stmt.Context, stmt.SQL.String(), stmt.Vars...)
+	r.db.Logger.Trace(stmt.Context, begin, func() (string, int64) {
+		var rows int64
+		if result != nil {
+			rows, _ = result.RowsAffected()
+		}
+		return r.db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...), rows
+	}, err)
+	return err
+}
+
+// FileRecord FileRecorder 写入的一行
+type FileRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Statement   string          `json:"statement"`
+	DurationMs  float64         `json:"duration_ms"`
+	Count       int64           `json:"count"`
+	Plan        json.RawMessage `json:"plan,omitempty"`
+	At          time.Time       `json:"at"`
+}
+
+// FileRecorder 每次慢查询以 JSON 行写入 w，Count 为进程启动以来该指纹出现的次数
+type FileRecorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	counts map[string]int64
+}
+
+// NewFileRecorder 创建写入 w 的 FileRecorder
+func NewFileRecorder(w io.Writer) *FileRecorder {
+	return &FileRecorder{w: w, counts: map[string]int64{}}
+}
+
+// Record implements Recorder
+func (r *FileRecorder) Record(ctx context.Context, query Query) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[query.Fingerprint]++
+	record := FileRecord{
+		Fingerprint: query.Fingerprint,
+		Statement:   query.Statement,
+		DurationMs:  float64(query.Duration.Nanoseconds()) / 1e6,
+		Count:       r.counts[query.Fingerprint],
+		At:          query.At,
+	}
+	if query.Plan != "" {
+		record.Plan = json.RawMessage(query.Plan)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+// Counts 返回每个指纹出现的次数
+func (r *FileRecorder) Counts() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int64, len(r.counts))
+	for fingerprint, count := range r.counts {
+		counts[fingerprint] = count
+	}
+	return counts
+}
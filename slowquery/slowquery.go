@@ -0,0 +1,223 @@
+package slowquery
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zhang1github2test/gorm-learning/tracing"
+	"gorm.io/gorm"
+)
+
+// DefaultThreshold 默认的慢查询阈值，与 database/db.go 中日志的 SlowThreshold 一致
+const DefaultThreshold = time.Second
+
+// Query 一次慢查询
+type Query struct {
+	// Fingerprint 归一化后 SQL 的 SHA-1，参数不同、IN 列表长度不同的同一类语句指纹相同
+	Fingerprint string
+	// Statement 归一化后的 SQL，不包含参数值
+	Statement string
+	Duration  time.Duration
+	// Plan EXPLAIN 的结果，JSON 数组，每行一个对象；无法 EXPLAIN 的语句（DDL 等）为空
+	Plan string
+	At   time.Time
+}
+
+// Recorder 记录慢查询，NewTableRecorder 写入 slow_queries 表，NewFileRecorder 以 JSON 行写入文件
+type Recorder interface {
+	Record(ctx context.Context, query Query) error
+}
+
+// Config 慢查询配置
+type Config struct {
+	// Threshold 慢查询阈值，为 0 时为 DefaultThreshold
+	Threshold time.Duration
+	// Analyze 对 SELECT 使用 EXPLAIN ANALYZE（MySQL 8.0.18+），会再实际执行一次查询；
+	// 修改语句和 SQLite 始终只使用 EXPLAIN
+	Analyze bool
+	// Recorder 为空时为写入同一个库的 NewTableRecorder，slow_queries 表需要先通过 Migrate 创建
+	Recorder Recorder
+}
+
+// analyzer 慢查询回调
+type analyzer struct {
+	config Config
+}
+
+// 语句中保存开始时间和待记录的慢查询的 key
+const (
+	startKey = "slowquery:start"
+	queryKey = "slowquery:query"
+)
+
+// Register 注册慢查询回调：语句耗时超过阈值时，在执行它的同一个连接池（事务中为同一个事务，dbresolver 选中的读库或写库）上
+// EXPLAIN 这条语句，再把指纹、耗时和执行计划交给 Recorder。耗时只统计语句本身，不包括事务的开启和提交。
+// 新增、更新、删除在默认事务提交后才交给 Recorder，TableRecorder 写入时不需要等待这个事务占用的连接。
+// Row/Rows（包括 Scan）返回时结果集还没有读取，连接仍被占用，只记录 SQL 和耗时，不执行 EXPLAIN
+func Register(db *gorm.DB, config Config) error {
+	if config.Threshold == 0 {
+		config.Threshold = DefaultThreshold
+	}
+	if config.Recorder == nil {
+		recorder, err := NewTableRecorder(db)
+		if err != nil {
+			return err
+		}
+		config.Recorder = recorder
+	}
+	a := &analyzer{config: config}
+	db.Callback().Create().Before("gorm:create").Register("customer:slowquery_create_start", start)
+	db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("customer:slowquery_create_explain", a.capture)
+	db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register("customer:slowquery_create", a.record)
+	db.Callback().Query().Before("gorm:query").Register("customer:slowquery_query_start", start)
+	db.Callback().Query().After("gorm:query").Register("customer:slowquery_query", a.check)
+	db.Callback().Update().Before("gorm:update").Register("customer:slowquery_update_start", start)
+	db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("customer:slowquery_update_explain", a.capture)
+	db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register("customer:slowquery_update", a.record)
+	db.Callback().Delete().Before("gorm:delete").Register("customer:slowquery_delete_start", start)
+	db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("customer:slowquery_delete_explain", a.capture)
+	db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register("customer:slowquery_delete", a.record)
+	db.Callback().Row().Before("gorm:row").Register("customer:slowquery_row_start", start)
+	db.Callback().Row().After("gorm:row").Register("customer:slowquery_row", a.checkRow)
+	db.Callback().Raw().Before("gorm:raw").Register("customer:slowquery_raw_start", start)
+	db.Callback().Raw().After("gorm:raw").Register("customer:slowquery_raw", a.check)
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+// check 耗时超过阈值时 EXPLAIN 并记录
+func (a *analyzer) check(db *gorm.DB) {
+	a.capture(db)
+	a.record(db)
+}
+
+// checkRow 耗时超过阈值时记录，不执行 EXPLAIN
+func (a *analyzer) checkRow(db *gorm.DB) {
+	if query, ok := a.slow(db); ok {
+		db.InstanceSet(queryKey, query)
+	}
+	a.record(db)
+}
+
+// capture 耗时超过阈值时 EXPLAIN，慢查询保存在语句中由 record 记录
+func (a *analyzer) capture(db *gorm.DB) {
+	query, ok := a.slow(db)
+	if !ok {
+		return
+	}
+	plan, err := a.explain(db, db.Statement.SQL.String())
+	if err != nil {
+		db.Logger.Warn(db.Statement.Context, "slowquery: explain %s: %v", query.Statement, err)
+	}
+	query.Plan = plan
+	db.InstanceSet(queryKey, query)
+}
+
+// slow 耗时超过阈值时返回没有执行计划的慢查询
+func (a *analyzer) slow(db *gorm.DB) (Query, bool) {
+	value, ok := db.InstanceGet(startKey)
+	if !ok {
+		return Query{}, false
+	}
+	elapsed := time.Since(value.(time.Time))
+	statement := db.Statement.SQL.String()
+	if elapsed < a.config.Threshold || statement == "" || db.Statement.Table == (SlowQuery{}).TableName() {
+		return Query{}, false
+	}
+	normalized := Normalize(statement)
+	return Query{Fingerprint: Fingerprint(normalized), Statement: normalized, Duration: elapsed, At: time.Now()}, true
+}
+
+// record 把 capture 保存的慢查询交给 Recorder
+func (a *analyzer) record(db *gorm.DB) {
+	value, ok := db.InstanceGet(queryKey)
+	if !ok {
+		return
+	}
+	query := value.(Query)
+	if err := a.config.Recorder.Record(db.Statement.Context, query); err != nil {
+		db.Logger.Error(db.Statement.Context, "slowquery: record %s: %v", query.Statement, err)
+	}
+}
+
+var (
+	explainable = regexp.MustCompile(`(?i)^\s*(SELECT|INSERT|UPDATE|DELETE|REPLACE|WITH)\b`)
+	selectSQL   = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+)
+
+// explain 在语句使用的连接池上执行 EXPLAIN，不经过 GORM 的回调
+func (a *analyzer) explain(db *gorm.DB, statement string) (string, error) {
+	if !explainable.MatchString(statement) {
+		return "", nil
+	}
+	prefix := "EXPLAIN "
+	switch {
+	case db.Dialector.Name() == "sqlite":
+		prefix = "EXPLAIN QUERY PLAN "
+	case a.config.Analyze && selectSQL.MatchString(statement):
+		prefix = "EXPLAIN ANALYZE "
+	}
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, prefix+statement, db.Statement.Vars...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	plan := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if values[i].Valid {
+				row[column] = values[i].String
+			} else {
+				row[column] = nil
+			}
+		}
+		plan = append(plan, row)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(plan)
+	return string(data), err
+}
+
+var (
+	whitespace = regexp.MustCompile(`\s+`)
+	valueList  = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	tupleList  = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+)
+
+// Normalize 归一化 SQL：字面量替换为 ?（与 tracing.Sanitize 相同），合并空白，转为小写，
+// IN (?,?,?) 和批量插入的多组 VALUES 合并为一个 (?)
+func Normalize(statement string) string {
+	normalized := whitespace.ReplaceAllString(strings.TrimSpace(tracing.Sanitize(statement)), " ")
+	normalized = valueList.ReplaceAllString(strings.ToLower(normalized), "(?)")
+	return tupleList.ReplaceAllString(normalized, "(?)")
+}
+
+// Fingerprint 归一化后 SQL 的 SHA-1
+func Fingerprint(normalized string) string {
+	sum := sha1.Sum([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,183 @@
+package slowquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+	Age  int
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSlowQuery_Table(t *testing.T) {
+	db := openDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{Threshold: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]testUser{{ID: 1, Name: "zhang", Age: 18}, {ID: 2, Name: "li", Age: 20}})
+	db.Where("age > ?", 18).Find(&[]testUser{})
+	db.Where("age > ?", 30).Find(&[]testUser{})
+	db.Where("id IN ?", []int{1, 2}).Find(&[]testUser{})
+	db.Where("id IN ?", []int{1, 2, 3}).Find(&[]testUser{})
+	db.Exec("CREATE INDEX idx_test_users_age ON test_users(age)")
+
+	var records []SlowQuery
+	if err := db.Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		statement string
+		count     int64
+		plan      string
+	}{
+		{name: "batch insert", statement: "insert into `test_users` (`name`,`age`,`id`) values (?) returning `id`", count: 1, plan: "CONSTANT ROWS"},
+		{name: "same fingerprint with different params", statement: "select * from `test_users` where age > ?", count: 2, plan: "SCAN test_users"},
+		{name: "in list of any length", statement: "select * from `test_users` where id in (?)", count: 2, plan: "SEARCH test_users"},
+		{name: "ddl has no plan", statement: "create index idx_test_users_age on test_users(age)", count: 1},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("records got %d, want %d: %+v", len(records), len(tests), records)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := records[i]
+			if record.Statement != tt.statement || record.Count != tt.count || record.Fingerprint != Fingerprint(tt.statement) {
+				t.Errorf("record got = %+v", record)
+			}
+			if tt.plan == "" && record.Plan != "" || !strings.Contains(record.Plan, tt.plan) {
+				t.Errorf("plan got = %s, want %s", record.Plan, tt.plan)
+			}
+			if record.TotalMs < record.MaxMs || record.MaxMs <= 0 {
+				t.Errorf("duration got total %v, max %v", record.TotalMs, record.MaxMs)
+			}
+		})
+	}
+}
+
+// TestTableRecorder_SkipsCallbacks 写入 slow_queries 不经过回调链
+func TestTableRecorder_SkipsCallbacks(t *testing.T) {
+	db := openDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{Threshold: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	db.Callback().Create().After("gorm:create").Register("test:tables", func(db *gorm.DB) {
+		tables = append(tables, db.Statement.Table)
+	})
+	for i := 1; i <= 2; i++ {
+		if err := db.Create(&testUser{ID: uint(i), Name: "zhang"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var record SlowQuery
+	if err := db.Where("statement LIKE ?", "insert%").First(&record).Error; err != nil || record.Count != 2 {
+		t.Errorf("slow query got = %+v, %v", record, err)
+	}
+	if len(tables) != 2 || tables[0] != "test_users" || tables[1] != "test_users" {
+		t.Errorf("create callbacks ran for %v", tables)
+	}
+}
+
+func TestSlowQuery_File(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		want      []int64
+	}{
+		{name: "slow", threshold: time.Nanosecond, want: []int64{1, 2}},
+		{name: "fast", threshold: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			recorder := NewFileRecorder(&buf)
+			db := openDB(t)
+			if err := Register(db, Config{Threshold: tt.threshold, Recorder: recorder}); err != nil {
+				t.Fatal(err)
+			}
+			db.First(&testUser{}, 1)
+			db.First(&testUser{}, 2)
+
+			var counts []int64
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var record FileRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatal(err)
+				}
+				if len(record.Plan) == 0 {
+					t.Errorf("plan should be recorded: %s", line)
+				}
+				counts = append(counts, record.Count)
+			}
+			if len(counts) != len(tt.want) || len(tt.want) > 0 && counts[1] != tt.want[1] {
+				t.Errorf("counts got = %v, want %v", counts, tt.want)
+			}
+			if db.Migrator().HasTable(&SlowQuery{}) {
+				t.Error("slow_queries should not be created with a file recorder")
+			}
+		})
+	}
+}
+
+// TestRegister_NoMigrate Register 使用 TableRecorder 时不建表
+func TestRegister_NoMigrate(t *testing.T) {
+	db := openDB(t)
+	if err := Register(db, Config{Threshold: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable(&SlowQuery{}) {
+		t.Error("Register() should not create slow_queries, use Migrate")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "SELECT * FROM users WHERE name = 'zhang'\n  AND age > 18", want: "select * from users where name = ? and age > ?"},
+		{sql: "SELECT * FROM users WHERE id IN (1, 2, 3)", want: "select * from users where id in (?)"},
+		{sql: "INSERT INTO users (name,age) VALUES (?,?),(?,?)", want: "insert into users (name,age) values (?)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := Normalize(tt.sql); got != tt.want {
+				t.Errorf("Normalize() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
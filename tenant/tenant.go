@@ -0,0 +1,261 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+)
+
+// DefaultColumn 默认的租户列
+const DefaultColumn = "tenant_id"
+
+var (
+	// ErrMissingTenant 操作带租户列的模型时 context 中没有租户，也没有通过 Bypass 显式跳过
+	ErrMissingTenant = errors.New("tenant: missing tenant in context")
+	// ErrTenantMismatch 写入的租户列与 context 中的租户不一致
+	ErrTenantMismatch = errors.New("tenant: tenant column does not match the tenant in context")
+)
+
+type tenantKey struct{}
+
+type bypassKey struct{}
+
+// WithTenant 在 context 中设置当前租户，通过 db.WithContext(ctx) 传给语句
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// FromContext 返回 WithTenant 设置的租户
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// Bypass 返回跳过租户隔离的 context，用于后台任务、跨租户统计等需要访问全部租户数据的场景
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// Config 租户隔离配置
+type Config struct {
+	// Column 租户列名，为空时为 DefaultColumn。只有包含该列的模型会被隔离，其他模型（例如公共字典表）不受影响
+	Column string
+	// Resolver 返回租户使用的 dbresolver 名称，用于每个租户一个库（schema）的部署，为空字符串时使用默认的连接。
+	// 名称需要事先通过 dbresolver.Register(dbresolver.Config{...}, "名称") 注册
+	Resolver func(tenantID string) string
+}
+
+// tenancy 租户隔离回调
+type tenancy struct {
+	config Config
+}
+
+// Register 注册租户隔离回调：查询、更新、删除带租户列的模型时加上 租户列 = 当前租户 的条件，新增时写入当前租户；
+// context 中没有租户时返回 ErrMissingTenant。条件只加在主表上，Joins 关联的表需要自行过滤（Preload 的查询会单独隔离）；
+// Raw、Exec 以及只指定 Table 没有模型的语句不做处理。配置了 Config.Resolver 时，有租户的语句路由到租户对应的 dbresolver
+func Register(db *gorm.DB, config Config) error {
+	if config.Column == "" {
+		config.Column = DefaultColumn
+	}
+	t := &tenancy{config: config}
+	db.Callback().Create().Before("gorm:begin_transaction").Register("customer:tenant_route_create", t.route(func(db *gorm.DB) func(*gorm.DB) {
+		return db.Callback().Create().Get("gorm:db_resolver")
+	}))
+	db.Callback().Update().Before("gorm:begin_transaction").Register("customer:tenant_route_update", t.route(func(db *gorm.DB) func(*gorm.DB) {
+		return db.Callback().Update().Get("gorm:db_resolver")
+	}))
+	db.Callback().Delete().Before("gorm:begin_transaction").Register("customer:tenant_route_delete", t.route(func(db *gorm.DB) func(*gorm.DB) {
+		return db.Callback().Delete().Get("gorm:db_resolver")
+	}))
+	db.Callback().Query().Before("gorm:query").Register("customer:tenant_route_query", t.route(func(db *gorm.DB) func(*gorm.DB) {
+		return db.Callback().Query().Get("gorm:db_resolver")
+	}))
+	db.Callback().Row().Before("gorm:row").Register("customer:tenant_route_row", t.route(func(db *gorm.DB) func(*gorm.DB) {
+		return db.Callback().Row().Get("gorm:db_resolver")
+	}))
+	db.Callback().Create().Before("gorm:create").Register("customer:tenant_create", t.stamp)
+	db.Callback().Query().Before("gorm:query").Register("customer:tenant_query", t.scope)
+	db.Callback().Row().Before("gorm:row").Register("customer:tenant_row", t.scope)
+	db.Callback().Update().Before("gorm:update").Register("customer:tenant_update", t.scopeWrite)
+	db.Callback().Delete().Before("gorm:delete").Register("customer:tenant_delete", t.scopeWrite)
+	return nil
+}
+
+// tenantField 返回语句模型的租户字段，模型没有租户列时返回 nil
+func (t *tenancy) tenantField(db *gorm.DB) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField(t.config.Column)
+}
+
+// tenantOf 返回语句的租户，第二个返回值表示是否需要隔离。模型带租户列而 context 中没有租户时记录 ErrMissingTenant
+func (t *tenancy) tenantOf(db *gorm.DB) (*schema.Field, string, bool) {
+	field := t.tenantField(db)
+	if field == nil || db.Error != nil || bypassed(db.Statement.Context) {
+		return nil, "", false
+	}
+	tenantID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(fmt.Errorf("%w: %s", ErrMissingTenant, db.Statement.Schema.Table))
+		return nil, "", false
+	}
+	return field, tenantID, true
+}
+
+// route 按 Config.Resolver 把有租户的语句路由到租户的 dbresolver。
+// dbresolver.Use 会按查询重新选择连接，写操作需要再调用一次当前回调链中的 gorm:db_resolver 切换到写库
+func (t *tenancy) route(resolver func(db *gorm.DB) func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if t.config.Resolver == nil || db.Error != nil || bypassed(db.Statement.Context) {
+			return
+		}
+		tenantID, ok := FromContext(db.Statement.Context)
+		if !ok {
+			return
+		}
+		name := t.config.Resolver(tenantID)
+		if name == "" {
+			return
+		}
+		if modifier, ok := dbresolver.Use(name).(gorm.StatementModifier); ok {
+			modifier.ModifyStatement(db.Statement)
+		}
+		if fc := resolver(db); fc != nil {
+			fc(db)
+		}
+	}
+}
+
+// where 租户条件
+func (t *tenancy) where(field *schema.Field, tenantID string) clause.Where {
+	return clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}}
+}
+
+// scope 查询时加上租户条件
+func (t *tenancy) scope(db *gorm.DB) {
+	if field, tenantID, ok := t.tenantOf(db); ok {
+		db.Statement.AddClause(t.where(field, tenantID))
+	}
+}
+
+// scopeWrite 更新和删除时加上租户条件，并检查更新的值没有修改租户列。
+// 租户条件本身不算作 WHERE 条件：既没有其他条件也没有主键时仍然按 GORM 的规则返回 ErrMissingWhereClause
+func (t *tenancy) scopeWrite(db *gorm.DB) {
+	field, tenantID, ok := t.tenantOf(db)
+	if !ok {
+		return
+	}
+	if _, hasWhere := db.Statement.Clauses["WHERE"]; !hasWhere && !db.AllowGlobalUpdate && !hasPrimaryKey(db) {
+		db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	t.checkDest(db, field, tenantID)
+	db.Statement.AddClause(t.where(field, tenantID))
+}
+
+// stamp 新增时写入当前租户，记录中已经指定了其他租户时返回 ErrTenantMismatch
+func (t *tenancy) stamp(db *gorm.DB) {
+	field, tenantID, ok := t.tenantOf(db)
+	if !ok {
+		return
+	}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		db.Statement.Dest = t.stampMap(db, field, tenantID, dest)
+	case []map[string]interface{}:
+		values := make([]map[string]interface{}, len(dest))
+		for i, m := range dest {
+			values[i] = t.stampMap(db, field, tenantID, m)
+		}
+		db.Statement.Dest = values
+	default:
+		t.stampValue(db, field, tenantID, db.Statement.ReflectValue)
+	}
+}
+
+func (t *tenancy) stampValue(db *gorm.DB, field *schema.Field, tenantID string, rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			t.stampValue(db, field, tenantID, reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		value, zero := field.ValueOf(db.Statement.Context, rv)
+		if !zero {
+			if fmt.Sprint(value) != tenantID {
+				db.AddError(ErrTenantMismatch)
+			}
+			return
+		}
+		db.AddError(field.Set(db.Statement.Context, rv, tenantID))
+	}
+}
+
+// stampMap 返回写入了租户的 map 副本，不修改调用方的 map
+func (t *tenancy) stampMap(db *gorm.DB, field *schema.Field, tenantID string, m map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(m)+1)
+	for key, value := range m {
+		if key == field.Name || key == field.DBName {
+			if fmt.Sprint(value) != tenantID {
+				db.AddError(ErrTenantMismatch)
+			}
+			continue
+		}
+		values[key] = value
+	}
+	values[field.DBName] = tenantID
+	return values
+}
+
+// checkDest 检查 Updates/Update/Save 的值没有把记录改到其他租户，模型中租户列为零值时写入当前租户
+func (t *tenancy) checkDest(db *gorm.DB, field *schema.Field, tenantID string) {
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range dest {
+			if (key == field.Name || key == field.DBName) && fmt.Sprint(value) != tenantID {
+				db.AddError(ErrTenantMismatch)
+			}
+		}
+	case []map[string]interface{}:
+		return
+	default:
+		if db.Statement.Dest == db.Statement.Model {
+			break
+		}
+		if rv := reflect.Indirect(reflect.ValueOf(db.Statement.Dest)); rv.Kind() == reflect.Struct && rv.Type() == db.Statement.Schema.ModelType {
+			if value, zero := field.ValueOf(db.Statement.Context, rv); !zero && fmt.Sprint(value) != tenantID {
+				db.AddError(ErrTenantMismatch)
+			}
+		}
+	}
+	// 模型是其他租户的记录时拒绝更新，Save 会更新全部字段，模型中的租户列需要与当前租户一致
+	t.stampValue(db, field, tenantID, db.Statement.ReflectValue)
+}
+
+// hasPrimaryKey 判断模型是否带有主键值，GORM 会据此生成主键条件
+func hasPrimaryKey(db *gorm.DB) bool {
+	rv := db.Statement.ReflectValue
+	if rv.Kind() != reflect.Struct {
+		return rv.Kind() == reflect.Slice && rv.Len() > 0
+	}
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			return true
+		}
+	}
+	return false
+}
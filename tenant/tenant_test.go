@@ -0,0 +1,148 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type testStudent struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"size:32;index"`
+	Name     string `gorm:"size:32"`
+}
+
+// testGrade 没有租户列的公共表
+type testGrade struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func openDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testStudent{}, &testGrade{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTenant(t *testing.T) {
+	db := openDB(t, "file::memory:")
+	if err := Register(db, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	a := db.WithContext(WithTenant(context.Background(), "a"))
+	b := db.WithContext(WithTenant(context.Background(), "b"))
+
+	if err := a.Create(&[]testStudent{{Name: "zhang"}, {Name: "li"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	other := testStudent{Name: "wang"}
+	if err := b.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if other.TenantID != "b" {
+		t.Errorf("Create() should stamp the tenant, got %q", other.TenantID)
+	}
+	if err := a.Model(&testStudent{}).Create(map[string]interface{}{"name": "zhao"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func() *gorm.DB
+		wantErr error
+		rows    int64
+	}{
+		{name: "missing tenant", run: func() *gorm.DB { return db.Find(&[]testStudent{}) }, wantErr: ErrMissingTenant},
+		{name: "create other tenant", run: func() *gorm.DB { return a.Create(&testStudent{TenantID: "b", Name: "sun"}) }, wantErr: ErrTenantMismatch},
+		{name: "update to other tenant", run: func() *gorm.DB {
+			return a.Model(&testStudent{}).Where("name = ?", "zhang").Updates(map[string]interface{}{"tenant_id": "b"})
+		}, wantErr: ErrTenantMismatch},
+		{name: "update other tenant's record", run: func() *gorm.DB { return a.Model(&other).Update("name", "zhou") }, wantErr: ErrTenantMismatch},
+		{name: "update without where", run: func() *gorm.DB { return a.Model(&testStudent{}).Update("name", "zhou") }, wantErr: gorm.ErrMissingWhereClause},
+		{name: "find", run: func() *gorm.DB { return a.Find(&[]testStudent{}) }, rows: 3},
+		{name: "update", run: func() *gorm.DB { return a.Model(&testStudent{}).Where("name <> ?", "").Update("name", "zhou") }, rows: 3},
+		{name: "delete", run: func() *gorm.DB { return b.Where("name = ?", "zhou").Delete(&testStudent{}) }, rows: 0},
+		{name: "shared table", run: func() *gorm.DB { return db.Create(&testGrade{Name: "grade 1"}) }, rows: 1},
+		{name: "bypass", run: func() *gorm.DB { return db.WithContext(Bypass(context.Background())).Find(&[]testStudent{}) }, rows: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.run()
+			if !errors.Is(tx.Error, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", tx.Error, tt.wantErr)
+			}
+			if tt.wantErr == nil && tx.RowsAffected != tt.rows {
+				t.Errorf("RowsAffected = %d, want %d", tx.RowsAffected, tt.rows)
+			}
+		})
+	}
+
+	var got testStudent
+	if err := b.First(&got).Error; err != nil || got.Name != "wang" {
+		t.Errorf("First() got = %+v, err = %v", got, err)
+	}
+}
+
+func TestTenant_Resolver(t *testing.T) {
+	dir := t.TempDir()
+	dsns := map[string]string{"a": filepath.Join(dir, "a.db"), "b": filepath.Join(dir, "b.db")}
+	for _, dsn := range dsns {
+		openDB(t, dsn)
+	}
+	db := openDB(t, "file::memory:")
+	resolver := dbresolver.Register(dbresolver.Config{Sources: []gorm.Dialector{sqlite.Open(dsns["a"])}}, "school_a").
+		Register(dbresolver.Config{Sources: []gorm.Dialector{sqlite.Open(dsns["b"])}}, "school_b")
+	if err := db.Use(resolver); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db, Config{Resolver: func(tenantID string) string { return "school_" + tenantID }}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := db.WithContext(WithTenant(context.Background(), "a"))
+	if err := a.Create(&testStudent{Name: "zhang"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create(&testGrade{Name: "grade 1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		db    *gorm.DB
+		model interface{}
+		want  int64
+	}{
+		{name: "tenant a", db: a, model: &testStudent{}, want: 1},
+		{name: "tenant a shared table", db: a, model: &testGrade{}, want: 1},
+		{name: "tenant b", db: db.WithContext(WithTenant(context.Background(), "b")), model: &testStudent{}, want: 0},
+		{name: "default", db: db.WithContext(Bypass(context.Background())), model: &testStudent{}, want: 0},
+		{name: "schema a", db: openDB(t, dsns["a"]), model: &testStudent{}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int64
+			if err := tt.db.Model(tt.model).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("Count() got = %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"errors"
+	"io"
+	"regexp"
+
+	"github.com/zhang1github2test/gorm-learning/internal/resolvermode"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// InstrumentationName tracer 的名称
+const InstrumentationName = "github.com/zhang1github2test/gorm-learning/tracing"
+
+// span 的属性
+const (
+	AttrSystem       = attribute.Key("db.system")
+	AttrOperation    = attribute.Key("db.operation")
+	AttrTable        = attribute.Key("db.sql.table")
+	AttrStatement    = attribute.Key("db.statement")
+	AttrRowsAffected = attribute.Key("db.rows_affected")
+	// AttrResolver dbresolver 选择的连接：source 或 replica，需要开启 dbresolver.Config.TraceResolverMode
+	AttrResolver = attribute.Key("db.resolver")
+)
+
+// Config 链路追踪配置
+type Config struct {
+	// TracerProvider 为空时在每次创建 span 时使用 otel.GetTracerProvider()，应用启动后再设置全局 provider 也会生效
+	TracerProvider trace.TracerProvider
+}
+
+// tracer 链路追踪回调
+type tracer struct {
+	config Config
+}
+
+// spanKey 语句中保存 span 的 key
+const spanKey = "tracing:span"
+
+// Register 注册链路追踪回调：每次执行回调链（新增、查询、更新、删除、Row、Raw）创建一个 span，
+// 父 span 取自 Statement.Context（通过 db.WithContext(ctx) 传入）。Statement.Context 中还保存着 dbresolver、mask 等回调的状态，
+// 这里不替换它，回调中再执行的语句（例如审计写入）与当前语句是同一个父 span 下的兄弟 span。
+// db.statement 为参数化的 SQL，字面量替换为 ?，不包含参数值
+func Register(db *gorm.DB, config Config) error {
+	t := &tracer{config: config}
+	db.Callback().Create().Before("*").Register("customer:tracing_create_start", t.start("create"))
+	db.Callback().Create().After("*").Register("customer:tracing_create", t.end)
+	db.Callback().Query().Before("*").Register("customer:tracing_query_start", t.start("query"))
+	db.Callback().Query().After("*").Register("customer:tracing_query", t.end)
+	db.Callback().Update().Before("*").Register("customer:tracing_update_start", t.start("update"))
+	db.Callback().Update().After("*").Register("customer:tracing_update", t.end)
+	db.Callback().Delete().Before("*").Register("customer:tracing_delete_start", t.start("delete"))
+	db.Callback().Delete().After("*").Register("customer:tracing_delete", t.end)
+	db.Callback().Row().Before("*").Register("customer:tracing_row_start", t.start("row"))
+	db.Callback().Row().After("*").Register("customer:tracing_row", t.end)
+	db.Callback().Raw().Before("*").Register("customer:tracing_raw_start", t.start("raw"))
+	db.Callback().Raw().After("*").Register("customer:tracing_raw", t.end)
+	return nil
+}
+
+func (t *tracer) provider() trace.TracerProvider {
+	if t.config.TracerProvider != nil {
+		return t.config.TracerProvider
+	}
+	return otel.GetTracerProvider()
+}
+
+// start 创建 span
+func (t *tracer) start(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		_, span := t.provider().Tracer(InstrumentationName).Start(db.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(AttrSystem.String(db.Dialector.Name()), AttrOperation.String(operation)))
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+// end 记录表、SQL、影响行数、读写库以及错误后结束 span
+func (t *tracer) end(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	attrs := []attribute.KeyValue{AttrRowsAffected.Int64(db.RowsAffected)}
+	if db.Statement.Table != "" {
+		attrs = append(attrs, AttrTable.String(db.Statement.Table))
+	}
+	if sql := db.Statement.SQL.String(); sql != "" {
+		attrs = append(attrs, AttrStatement.String(Sanitize(sql)))
+	}
+	if mode, ok := resolvermode.FromContext(db.Statement.Context); ok {
+		attrs = append(attrs, AttrResolver.String(string(mode)))
+	}
+	span.SetAttributes(attrs...)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// Sanitize 把 SQL 中的字符串和数字字面量替换为 ?，Raw、Exec 中直接拼接的值不会出现在 span 中
+func Sanitize(sql string) string {
+	return numericLiteral.ReplaceAllString(stringLiteral.ReplaceAllString(sql, "?"), "?")
+}
+
+// NewStdoutProvider 创建把 span 以 JSON 输出到 w 的 TracerProvider，用于本地调试，
+// 测试中可以使用 sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+func NewStdoutProvider(w io.Writer) (*sdktrace.TracerProvider, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil
+}
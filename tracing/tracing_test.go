@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type testUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func openDB(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的库，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	result := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+func TestTracing(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, "file::memory:")
+	source, replica := filepath.Join(dir, "source.db"), filepath.Join(dir, "replica.db")
+	openDB(t, source)
+	openDB(t, replica)
+	if err := db.Use(dbresolver.Register(dbresolver.Config{
+		Sources:           []gorm.Dialector{sqlite.Open(source)},
+		Replicas:          []gorm.Dialector{sqlite.Open(replica)},
+		TraceResolverMode: true,
+	})); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	if err := Register(db, Config{TracerProvider: provider}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "GET /users")
+	tx := db.WithContext(ctx)
+	tx.Create(&testUser{ID: 1, Name: "zhang"})
+	tx.Where("name = ?", "zhang").Find(&[]testUser{})
+	tx.Create(&testUser{ID: 1, Name: "zhang"})
+	tx.Exec("UPDATE test_users SET name = 'li' WHERE id = 1")
+	parent.End()
+
+	spans := exporter.GetSpans().Snapshots()
+	tests := []struct {
+		name      string
+		operation string
+		statement string
+		resolver  string
+		rows      int64
+		failed    bool
+	}{
+		{name: "gorm.create", operation: "create", statement: "INSERT INTO `test_users` (`name`,`id`) VALUES (?,?) RETURNING `id`", resolver: "source", rows: 1},
+		{name: "gorm.query", operation: "query", statement: "SELECT * FROM `test_users` WHERE name = ?", resolver: "replica"},
+		{name: "gorm.create", operation: "create", statement: "INSERT INTO `test_users` (`name`,`id`) VALUES (?,?) RETURNING `id`", resolver: "source", failed: true},
+		{name: "gorm.raw", operation: "raw", statement: "UPDATE test_users SET name = ? WHERE id = ?", resolver: "source", rows: 1},
+	}
+	if len(spans) != len(tests)+1 {
+		t.Fatalf("spans got %d, want %d", len(spans), len(tests)+1)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := spans[i]
+			got := attrs(span)
+			if span.Name() != tt.name || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("span got = %s, parent %s", span.Name(), span.Parent().SpanID())
+			}
+			if got[AttrOperation].AsString() != tt.operation || got[AttrStatement].AsString() != tt.statement || got[AttrResolver].AsString() != tt.resolver {
+				t.Errorf("attributes got = %v", got)
+			}
+			if got[AttrSystem].AsString() != "sqlite" || (tt.operation != "raw" && got[AttrTable].AsString() != "test_users") {
+				t.Errorf("attributes got = %v", got)
+			}
+			if !tt.failed && got[AttrRowsAffected].AsInt64() != tt.rows {
+				t.Errorf("rows affected got = %d, want %d", got[AttrRowsAffected].AsInt64(), tt.rows)
+			}
+			if failed := span.Status().Code == codes.Error; failed != tt.failed {
+				t.Errorf("status got = %v, want failed %v", span.Status(), tt.failed)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "SELECT * FROM users WHERE name = 'zhang' AND age > 18", want: "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{sql: "SELECT * FROM t1 WHERE note = 'it''s' LIMIT 10", want: "SELECT * FROM t1 WHERE note = ? LIMIT ?"},
+		{sql: "SELECT * FROM users WHERE id = ?", want: "SELECT * FROM users WHERE id = ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := Sanitize(tt.sql); got != tt.want {
+				t.Errorf("Sanitize() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStdoutProvider(t *testing.T) {
+	var buf bytes.Buffer
+	provider, err := NewStdoutProvider(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openDB(t, "file::memory:")
+	if err := Register(db, Config{TracerProvider: provider}); err != nil {
+		t.Fatal(err)
+	}
+	db.Find(&[]testUser{})
+	if !strings.Contains(buf.String(), `"Name": "gorm.query"`) {
+		t.Errorf("stdout exporter got = %s", buf.String())
+	}
+}